@@ -0,0 +1,529 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/config"
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/docker"
+	"github.com/cedrickring/kbuild/pkg/graph"
+	"github.com/cedrickring/kbuild/pkg/kaniko"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+//resolveBuilds returns all builds to run, either read from a kbuild.yaml and overridden by
+//the provided flags or created from the flags only
+func resolveBuilds(cmd *cobra.Command, args []string) ([]config.Build, graph.Options, error) {
+	flags := cmd.Flags()
+	opts := graph.Options{
+		Parallelism:       parallelism,
+		ContinueOnFailure: continueOnFailure,
+	}
+
+	configPath, err := findConfigFile()
+	if err != nil {
+		return nil, opts, err
+	}
+
+	var builds []config.Build
+	if configPath == "" {
+		if len(buildNames) > 0 {
+			return nil, opts, errors.New("--build requires a config file")
+		}
+
+		builds = []config.Build{{
+			Dockerfile:     dockerfile,
+			WorkDir:        workingDir,
+			Tags:           imageTags,
+			BuildArgs:      buildArgs,
+			BuildArgFiles:  buildArgFiles,
+			ContextMode:    contextMode,
+			Cache:          useCache,
+			CacheRepo:      cacheRepo,
+			Namespace:      namespace,
+			Bucket:         gcsBucket,
+			RegistrySecret: registrySecret,
+			PodOverlay:     podOverlay,
+		}}
+		applyTimeoutFlags(cmd, &builds[0].Timeouts)
+		applyKanikoFlags(cmd, &builds[0].Kaniko)
+		if err := applyPodFlags(cmd, &builds[0].Pod); err != nil {
+			return nil, opts, err
+		}
+	} else {
+		//without --config the config file is looked up in the --workdir, so its paths are already relative to it
+		if configFile != "" && flags.Changed("workdir") {
+			return nil, opts, errors.New("--workdir can't be used with --config, set workdir per build in the config file")
+		}
+
+		logrus.Infof("Using config file %s", configPath)
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return nil, opts, err
+		}
+
+		builds, err = cfg.Select(buildNames)
+		if err != nil {
+			return nil, opts, err
+		}
+
+		requested := make(map[string]bool)
+		for _, name := range buildNames {
+			requested[name] = true
+		}
+		for _, build := range builds {
+			if len(requested) > 0 && !requested[build.Name] {
+				logrus.Infof(`Selected build "%s" as dependency`, build.Name)
+			}
+		}
+
+		if flags.Changed("tag") && (len(requested) > 1 || len(requested) == 0 && len(builds) > 1) {
+			return nil, opts, errors.New("--tag can only be used with a single build, select one with --build")
+		}
+
+		if !flags.Changed("parallelism") && cfg.Parallelism > 0 {
+			opts.Parallelism = cfg.Parallelism
+		}
+		if !flags.Changed("continue-on-failure") {
+			opts.ContinueOnFailure = cfg.ContinueOnFailure
+		}
+
+		for i := range builds {
+			tags := builds[i].Tags
+			if err := applyFlags(cmd, &builds[i]); err != nil {
+				return nil, opts, err
+			}
+			if len(requested) > 0 && !requested[builds[i].Name] {
+				builds[i].Tags = tags //--tag only applies to the selected build, not to its dependencies
+			}
+		}
+	}
+
+	if len(args) > 0 {
+		for i := range builds {
+			builds[i].Source = args[0]
+		}
+	}
+
+	for i := range builds {
+		if err := validateBuild(&builds[i]); err != nil {
+			if builds[i].Name != "" {
+				return nil, opts, errors.Wrapf(err, "build %q", builds[i].Name)
+			}
+			return nil, opts, err
+		}
+	}
+
+	return builds, opts, nil
+}
+
+//findConfigFile returns the path of the config file provided by --config or the kbuild.yaml
+//in the working directory. An empty path is returned if there's no config file.
+func findConfigFile() (string, error) {
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return "", errors.Errorf("Can't find config file %s", configFile)
+		}
+		return configFile, nil
+	}
+
+	path := filepath.Join(workingDir, constants.ConfigFileName)
+	if _, err := os.Stat(path); err != nil {
+		return "", nil
+	}
+	return path, nil
+}
+
+//applyFlags overrides the values of the config file with all explicitly set flags
+func applyFlags(cmd *cobra.Command, b *config.Build) error {
+	flags := cmd.Flags()
+
+	if flags.Changed("dockerfile") || flags.Changed("file") {
+		b.Dockerfile = dockerfile
+	}
+	if flags.Changed("tag") {
+		b.Tags = imageTags
+	}
+	if flags.Changed("build-arg") {
+		b.BuildArgs = buildArgs
+	}
+	if flags.Changed("build-arg-file") {
+		b.BuildArgFiles = buildArgFiles
+	}
+	if flags.Changed("context-mode") {
+		b.ContextMode = contextMode
+	}
+	if flags.Changed("cache") {
+		b.Cache = useCache
+	}
+	if flags.Changed("cache-repo") {
+		b.CacheRepo = cacheRepo
+	}
+	if flags.Changed("namespace") {
+		b.Namespace = namespace
+	}
+	if flags.Changed("bucket") {
+		b.Bucket = gcsBucket
+	}
+	if flags.Changed("registry-secret") {
+		b.RegistrySecret = registrySecret
+	}
+	if flags.Changed("pod-overlay") {
+		b.PodOverlay = podOverlay
+	}
+	applyTimeoutFlags(cmd, &b.Timeouts)
+	applyKanikoFlags(cmd, &b.Kaniko)
+	return applyPodFlags(cmd, &b.Pod)
+}
+
+//applyTimeoutFlags overrides the timeouts with all explicitly set timeout flags
+func applyTimeoutFlags(cmd *cobra.Command, t *config.Timeouts) {
+	flags := cmd.Flags()
+
+	if flags.Changed("timeout") {
+		t.Total = timeouts.Total.String()
+	}
+	if flags.Changed("context-timeout") {
+		t.Context = timeouts.Context.String()
+	}
+	if flags.Changed("upload-timeout") {
+		t.Upload = timeouts.Upload.String()
+	}
+	if flags.Changed("pod-start-timeout") {
+		t.PodStart = timeouts.PodStart.String()
+	}
+	if flags.Changed("build-timeout") {
+		t.Build = timeouts.Build.String()
+	}
+	if flags.Changed("cleanup-timeout") {
+		t.Cleanup = timeouts.Cleanup.String()
+	}
+}
+
+//applyKanikoFlags overrides the executor flags with all explicitly set Kaniko flags.
+//Kaniko args passed with --kaniko-arg are appended to the args of the config file.
+func applyKanikoFlags(cmd *cobra.Command, k *config.Kaniko) {
+	flags := cmd.Flags()
+
+	stringFlags := []struct {
+		flag  string
+		value string
+		dest  *string
+	}{
+		{"target", executor.Target, &k.Target},
+		{"snapshot-mode", executor.SnapshotMode, &k.SnapshotMode},
+		{"registry-mirror", executor.RegistryMirror, &k.RegistryMirror},
+		{"tar-path", executor.TarPath, &k.TarPath},
+		{"digest-file", executor.DigestFile, &k.DigestFile},
+	}
+	for _, f := range stringFlags {
+		if flags.Changed(f.flag) {
+			*f.dest = f.value
+		}
+	}
+
+	boolFlags := []struct {
+		flag  string
+		value bool
+		dest  *bool
+	}{
+		{"single-snapshot", executor.SingleSnapshot, &k.SingleSnapshot},
+		{"reproducible", executor.Reproducible, &k.Reproducible},
+		{"insecure", executor.Insecure, &k.Insecure},
+		{"skip-tls-verify", executor.SkipTLSVerify, &k.SkipTLSVerify},
+		{"no-push", executor.NoPush, &k.NoPush},
+		{"use-new-run", executor.UseNewRun, &k.UseNewRun},
+	}
+	for _, f := range boolFlags {
+		if flags.Changed(f.flag) {
+			*f.dest = f.value
+		}
+	}
+
+	if flags.Changed("cache-ttl") {
+		k.CacheTTL = executor.CacheTTL.String()
+	}
+	if flags.Changed("label") {
+		k.Labels = executor.Labels
+	}
+	if flags.Changed("kaniko-arg") {
+		k.Args = append(append([]string{}, k.Args...), executor.ExtraArgs...)
+	}
+}
+
+//applyPodFlags overrides the pod options with all explicitly set pod flags
+func applyPodFlags(cmd *cobra.Command, p *config.Pod) error {
+	flags := cmd.Flags()
+
+	resources := []struct {
+		flag   string
+		values map[string]string
+		dest   *v1.ResourceList
+	}{
+		{"requests", requests, &p.Resources.Requests},
+		{"limits", limits, &p.Resources.Limits},
+		{"init-requests", initRequests, &p.InitResources.Requests},
+		{"init-limits", initLimits, &p.InitResources.Limits},
+	}
+	for _, r := range resources {
+		if !flags.Changed(r.flag) {
+			continue
+		}
+
+		list, err := config.ParseResourceList(r.values)
+		if err != nil {
+			return errors.Wrapf(err, "--%s", r.flag)
+		}
+		*r.dest = list
+	}
+
+	if flags.Changed("executor-image") {
+		p.ExecutorImage = executorImage
+	}
+	if flags.Changed("init-image") {
+		p.InitImage = initImage
+	}
+	if flags.Changed("image-pull-secret") {
+		p.ImagePullSecrets = imagePullSecrets
+	}
+	if flags.Changed("node-selector") {
+		p.NodeSelector = nodeSelector
+	}
+	if flags.Changed("toleration") {
+		p.Tolerations = nil
+		for _, value := range tolerations {
+			toleration, err := config.ParseToleration(value)
+			if err != nil {
+				return err
+			}
+			p.Tolerations = append(p.Tolerations, toleration)
+		}
+	}
+	if flags.Changed("affinity") {
+		parsed, err := config.ParseAffinity(affinity)
+		if err != nil {
+			return errors.Wrap(err, "--affinity")
+		}
+		p.Affinity = parsed
+	}
+	if flags.Changed("priority-class") {
+		p.PriorityClassName = priorityClass
+	}
+	if flags.Changed("service-account") {
+		p.ServiceAccountName = serviceAccount
+	}
+
+	return nil
+}
+
+//podOptions converts the pod options of the config file to the options used by the build
+func podOptions(p config.Pod) kaniko.PodOptions {
+	return kaniko.PodOptions{
+		ExecutorImage:      p.ExecutorImage,
+		InitImage:          p.InitImage,
+		ImagePullSecrets:   p.ImagePullSecrets,
+		Resources:          p.Resources,
+		InitResources:      p.InitResources,
+		NodeSelector:       p.NodeSelector,
+		Tolerations:        p.Tolerations,
+		Affinity:           p.Affinity,
+		PriorityClassName:  p.PriorityClassName,
+		ServiceAccountName: p.ServiceAccountName,
+	}
+}
+
+//executorOptions converts the Kaniko flags of the config file to the validated executor options used by the build
+func executorOptions(k config.Kaniko) (kaniko.ExecutorOptions, error) {
+	opts := kaniko.ExecutorOptions{
+		Target:         k.Target,
+		SnapshotMode:   k.SnapshotMode,
+		SingleSnapshot: k.SingleSnapshot,
+		Reproducible:   k.Reproducible,
+		Insecure:       k.Insecure,
+		SkipTLSVerify:  k.SkipTLSVerify,
+		RegistryMirror: k.RegistryMirror,
+		Labels:         k.Labels,
+		NoPush:         k.NoPush,
+		TarPath:        k.TarPath,
+		DigestFile:     k.DigestFile,
+		UseNewRun:      k.UseNewRun,
+		ExtraArgs:      k.Args,
+	}
+
+	if k.CacheTTL != "" {
+		ttl, err := time.ParseDuration(k.CacheTTL)
+		if err != nil {
+			return opts, errors.Wrapf(err, "parsing cache ttl %q", k.CacheTTL)
+		}
+		opts.CacheTTL = ttl
+	}
+
+	return opts, opts.Validate()
+}
+
+//parseTimeouts converts the timeouts of the config file to the durations used by the build
+func parseTimeouts(t config.Timeouts) (kaniko.Timeouts, error) {
+	var parsed kaniko.Timeouts
+	values := []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{t.Total, &parsed.Total},
+		{t.Context, &parsed.Context},
+		{t.Upload, &parsed.Upload},
+		{t.PodStart, &parsed.PodStart},
+		{t.Build, &parsed.Build},
+		{t.Cleanup, &parsed.Cleanup},
+	}
+
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(v.value)
+		if err != nil {
+			return parsed, errors.Wrapf(err, "parsing timeout %q", v.value)
+		}
+		*v.dest = d
+	}
+	return parsed, nil
+}
+
+//validateBuild sets defaults for unset values and validates the final build options
+func validateBuild(b *config.Build) error {
+	if b.Dockerfile == "" {
+		b.Dockerfile = "Dockerfile"
+	}
+	if b.Namespace == "" {
+		b.Namespace = namespace
+	}
+	b.Source = strings.ToLower(b.Source)
+
+	if len(b.Tags) == 0 {
+		return errors.New("Please provide at least one image tag via --tag or the config file")
+	}
+
+	if err := validateImageTags(b.Tags); err != nil {
+		return err
+	}
+
+	if b.Dockerfile == stdinArgument {
+		path, err := readStdinDockerfile()
+		if err != nil {
+			return err
+		}
+		b.Dockerfile = path
+	}
+
+	if err := checkForDockerfile(b.WorkDir, b.Dockerfile); err != nil {
+		return err
+	}
+
+	if err := docker.ValidateContextMode(b.ContextMode); err != nil {
+		return err
+	}
+
+	args, redact, err := docker.ResolveBuildArgs(b.BuildArgFiles, b.BuildArgs)
+	if err != nil {
+		return errors.Wrap(err, "resolving build args")
+	}
+	b.BuildArgs = args
+	b.RedactedBuildArgs = redact
+
+	if b.Source == constants.GCSArgument && b.Bucket == "" {
+		return errors.New("Please provide a bucket name via --bucket when using gcs")
+	}
+
+	if _, err := executorOptions(b.Kaniko); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateImageTags(tags []string) error {
+	for _, tag := range tags {
+		_, err := name.NewTag(tag, name.WeakValidation) //weak validation to allow only <registry/<repo> without a specific tag
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkForDockerfile(workDir, dockerfile string) error {
+	path := docker.LocalDockerfilePath(workDir, dockerfile)
+	if _, err := os.Stat(path); err != nil {
+		return errors.Errorf("Can't find Dockerfile %s", path)
+	}
+	if docker.ContextDockerfilePath(workDir, dockerfile) == constants.InjectedDockerfile {
+		logrus.Infof("Dockerfile %s is outside of the working directory, adding it to the build context as %s", path, constants.InjectedDockerfile)
+	}
+	return nil
+}
+
+//stdinArgument is the Dockerfile path which reads the Dockerfile from stdin
+const stdinArgument = "-"
+
+//stdinDockerfile is the temporary file the Dockerfile read from stdin is written to, stdin can only be read once for all builds
+var stdinDockerfile struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+//readStdinDockerfile reads the Dockerfile from stdin into a temporary file and returns its path
+func readStdinDockerfile() (string, error) {
+	stdinDockerfile.once.Do(func() {
+		f, err := ioutil.TempFile("", "kbuild-dockerfile-")
+		if err != nil {
+			stdinDockerfile.err = errors.Wrap(err, "creating temporary Dockerfile")
+			return
+		}
+		defer f.Close()
+		stdinDockerfile.path = f.Name()
+		logrus.RegisterExitHandler(removeStdinDockerfile)
+
+		if _, err := io.Copy(f, os.Stdin); err != nil {
+			stdinDockerfile.err = errors.Wrap(err, "reading Dockerfile from stdin")
+		}
+	})
+	return stdinDockerfile.path, stdinDockerfile.err
+}
+
+//removeStdinDockerfile removes the temporary file of the Dockerfile read from stdin, if any
+func removeStdinDockerfile() {
+	if stdinDockerfile.path == "" {
+		return
+	}
+	if err := os.Remove(stdinDockerfile.path); err != nil && !os.IsNotExist(err) {
+		logrus.Warn(errors.Wrap(err, "removing temporary Dockerfile"))
+	}
+}
@@ -0,0 +1,143 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/docker"
+	"github.com/cedrickring/kbuild/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsWorkDir       string
+	lsDockerfile    string
+	lsTarget        string
+	lsContextMode   string
+	lsBuildArgs     []string
+	lsBuildArgFiles []string
+)
+
+func contextCommand() *cobra.Command {
+	contextCmd := &cobra.Command{
+		Use:   "context",
+		Short: "Inspect the build context sent to the cluster.",
+	}
+
+	lsCmd := &cobra.Command{
+		Use:     "ls",
+		Example: "kbuild context ls -d Dockerfile.dev --context-mode full",
+		Short:   "List the files sent as build context and the pattern of the ignore file excluding each skipped file.",
+		Args:    cobra.NoArgs,
+		Run:     runContextLs,
+	}
+	lsCmd.Flags().StringVarP(&lsWorkDir, "workdir", "w", ".", "Working directory")
+	lsCmd.Flags().StringVarP(&lsDockerfile, "dockerfile", "d", "Dockerfile", "Path to the Dockerfile relative to the working directory, an absolute path or - to read it from stdin")
+	lsCmd.Flags().StringVarP(&lsDockerfile, "file", "f", "Dockerfile", "Alias of --dockerfile")
+	lsCmd.Flags().StringVarP(&lsTarget, "target", "", "", "The stage of a multi-stage Dockerfile to build")
+	lsCmd.Flags().StringVarP(&lsContextMode, "context-mode", "", constants.ContextModeReferenced, "Files sent as build context, referenced or full")
+	lsCmd.Flags().StringArrayVarP(&lsBuildArgs, "build-arg", "", nil, "Optional build arguments (ARG) as KEY=VALUE or KEY to use the value of the environment (can be repeated)")
+	lsCmd.Flags().StringSliceVarP(&lsBuildArgFiles, "build-arg-file", "", nil, "Path(s) to files with build arguments in dotenv format, overridden by --build-arg")
+
+	contextCmd.AddCommand(lsCmd)
+	return contextCmd
+}
+
+func runContextLs(cmd *cobra.Command, args []string) {
+	setupLogrus()
+	defer removeStdinDockerfile()
+
+	if err := docker.ValidateContextMode(lsContextMode); err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	dockerfile := lsDockerfile
+	if dockerfile == stdinArgument {
+		path, err := readStdinDockerfile()
+		if err != nil {
+			logrus.Fatal(err)
+			return
+		}
+		dockerfile = path
+	}
+	if err := checkForDockerfile(lsWorkDir, dockerfile); err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	buildArgs, _, err := docker.ResolveBuildArgs(lsBuildArgFiles, lsBuildArgs)
+	if err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	listing, err := docker.ListContext(lsWorkDir, dockerfile, lsTarget, lsContextMode, buildArgs)
+	if err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	if listing.IgnoreFile != "" {
+		logrus.Infof("Using ignore file %s", listing.IgnoreFile)
+	} else {
+		logrus.Info("No ignore file found")
+	}
+
+	printContext(listing, os.Stdout)
+
+	other := constants.ContextModeFull
+	if lsContextMode == constants.ContextModeFull {
+		other = constants.ContextModeReferenced
+	}
+	stats, err := docker.GetContextStats(lsWorkDir, dockerfile, lsTarget, other, buildArgs)
+	if err != nil {
+		logrus.Warn(errors.Wrap(err, "comparing context modes"))
+		return
+	}
+	logrus.Infof("%s context mode would send %d files (%s)", other, stats.Files, util.FormatBytes(stats.Size))
+}
+
+//printContext prints all files sent as build context and all excluded files and directories with the pattern excluding them
+func printContext(listing *docker.ContextListing, out io.Writer) {
+	var sent, excluded int
+	var size int64
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tSIZE\tPATH\tEXCLUDED BY")
+	for _, e := range listing.Entries {
+		if e.Excluded {
+			excluded++
+			fmt.Fprintf(w, "excluded\t-\t%s\t%s\n", e.Name, e.Pattern)
+			continue
+		}
+
+		sent++
+		size += e.Size
+		fmt.Fprintf(w, "sent\t%s\t%s\t\n", util.FormatBytes(e.Size), e.Name)
+	}
+	_ = w.Flush()
+
+	logrus.Infof("%d files (%s) are sent, %d files and directories are excluded", sent, util.FormatBytes(size), excluded)
+}
@@ -0,0 +1,73 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cedrickring/kbuild/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+//Output formats of --dry-run
+const (
+	outputYAML = "yaml"
+	outputJSON = "json"
+)
+
+//printPlans prints the build plans of all builds without contacting the cluster.
+//Plans are printed as yaml documents or as a stream of json objects.
+func printPlans(builds []config.Build, format string, out io.Writer) error {
+	if format != outputYAML && format != outputJSON {
+		return errors.Errorf("unknown output format %s, must be %s or %s", format, outputYAML, outputJSON)
+	}
+
+	for i, build := range builds {
+		b, err := newKanikoBuild(logrus.NewEntry(logrus.StandardLogger()), build)
+		if err != nil {
+			return err
+		}
+
+		plan, err := b.RenderPlan()
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		if format == outputJSON {
+			data, err = json.MarshalIndent(plan, "", "  ")
+			data = append(data, '\n')
+		} else {
+			data, err = yaml.Marshal(plan)
+		}
+		if err != nil {
+			return errors.Wrap(err, "encoding plan")
+		}
+
+		if i > 0 && format == outputYAML {
+			fmt.Fprintln(out, "---")
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
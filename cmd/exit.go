@@ -0,0 +1,70 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/cedrickring/kbuild/pkg/kaniko"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+//Exit codes of kbuild, all other errors exit with 1
+const (
+	exitBuildFailed   = 2
+	exitOOMKilled     = 3
+	exitEvicted       = 4
+	exitTimeout       = 5
+	exitPodStartError = 6
+	exitCancelled     = 130
+)
+
+//exitCode returns the exit code matching the error returned by a build
+func exitCode(err error) int {
+	cause := errors.Cause(err)
+
+	switch cause.(type) {
+	case kubernetes.PodStartError:
+		return exitPodStartError
+	case kaniko.TimeoutError:
+		return exitTimeout
+	}
+
+	switch cause {
+	case kaniko.ErrorBuildFailed:
+		return exitBuildFailed
+	case kaniko.ErrorOOMKilled:
+		return exitOOMKilled
+	case kaniko.ErrorEvicted:
+		return exitEvicted
+	case kaniko.ErrorTimeout:
+		return exitTimeout
+	case kaniko.ErrorCancelled, context.Canceled:
+		return exitCancelled
+	}
+	return 1
+}
+
+//exitWithError logs the error and exits with the exit code matching the error
+func exitWithError(err error) {
+	logrus.Error(err)
+	removeStdinDockerfile()
+	os.Exit(exitCode(err))
+}
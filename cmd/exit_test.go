@@ -0,0 +1,50 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cedrickring/kbuild/pkg/kaniko"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/pkg/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "unknown error", err: errors.New("getting kubernetes client"), expected: 1},
+		{name: "non-zero exit code", err: kaniko.Result{ExitCode: 1, Message: "error building image"}.Err(), expected: exitBuildFailed},
+		{name: "oom killed", err: kaniko.Result{ExitCode: 137, Reason: "OOMKilled"}.Err(), expected: exitOOMKilled},
+		{name: "evicted", err: errors.Wrapf(kubernetes.ErrorPodEvicted, "pod %s: %s", "kaniko", "node is low on memory"), expected: exitEvicted},
+		{name: "container deadline exceeded", err: kaniko.Result{Reason: "DeadlineExceeded"}.Err(), expected: exitTimeout},
+		{name: "phase timeout", err: errors.Wrap(kaniko.TimeoutError{Phase: kaniko.PhasePodStart}, "building app"), expected: exitTimeout},
+		{name: "pod start error", err: kubernetes.PodStartError{Pod: "kaniko", Reason: "ErrImagePull"}, expected: exitPodStartError},
+		{name: "cancelled", err: kaniko.ErrorCancelled, expected: exitCancelled},
+		{name: "context cancelled", err: errors.Wrap(context.Canceled, "watching pod"), expected: exitCancelled},
+	}
+
+	for _, test := range tests {
+		if actual := exitCode(test.err); actual != test.expected {
+			t.Errorf("%s: expected exit code %d but got %d", test.name, test.expected, actual)
+		}
+	}
+}
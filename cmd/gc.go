@@ -0,0 +1,130 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/gc"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcNamespace string
+	gcBucket    string
+	gcOlderThan time.Duration
+	gcDryRun    bool
+	gcYes       bool
+)
+
+func gcCommand() *cobra.Command {
+	gcCmd := &cobra.Command{
+		Use:     "gc",
+		Example: "kbuild gc --older-than 2h",
+		Short:   "Delete pods, secrets and build contexts left behind by killed builds.",
+		Args:    cobra.NoArgs,
+		Run:     runGC,
+	}
+	gcCmd.Flags().StringVarP(&gcNamespace, "namespace", "n", "default", "The namespace to search for left behind resources")
+	gcCmd.Flags().StringVarP(&gcBucket, "bucket", "b", "", "The bucket to search for left behind build contexts")
+	gcCmd.Flags().DurationVarP(&gcOlderThan, "older-than", "", time.Hour, "Min age of the resources to delete")
+	gcCmd.Flags().BoolVarP(&gcDryRun, "dry-run", "", false, "Only list the resources which would be deleted")
+	gcCmd.Flags().BoolVarP(&gcYes, "yes", "y", false, "Delete the resources without asking for confirmation")
+	return gcCmd
+}
+
+func runGC(cmd *cobra.Command, args []string) {
+	setupLogrus()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	catchCtrlC(cancel)
+
+	kubernetes.Configure(kubeconfig, kubeContext)
+
+	resources, err := gc.Find(ctx, gc.Options{
+		Namespace: gcNamespace,
+		Bucket:    gcBucket,
+		OlderThan: gcOlderThan,
+	})
+	if err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	if len(resources) == 0 {
+		logrus.Infof("No resources older than %s found.", gcOlderThan)
+		return
+	}
+
+	printResources(resources)
+
+	if gcDryRun {
+		return
+	}
+	if !gcYes && !confirm(fmt.Sprintf("Delete %d resources?", len(resources))) {
+		logrus.Info("Aborted.")
+		return
+	}
+
+	if err := gc.Delete(ctx, resources); err != nil {
+		logrus.Fatal(err)
+		return
+	}
+	logrus.Infof("Deleted %d resources.", len(resources))
+}
+
+func printResources(resources []gc.Resource) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tBUILD\tAGE\tCREATED BY")
+	for _, r := range resources {
+		build := r.BuildName
+		if build == "" {
+			build = r.BuildID
+		}
+
+		name := r.Name
+		if r.Kind == gc.KindGCSObject {
+			name = r.String()
+		}
+
+		age := time.Since(r.Created).Round(time.Second)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Kind, name, build, age, r.CreatedBy)
+	}
+	_ = w.Flush()
+}
+
+//confirm asks the user the question and returns true if it was answered with yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
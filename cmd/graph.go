@@ -0,0 +1,96 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/config"
+	"github.com/cedrickring/kbuild/pkg/graph"
+	"github.com/cedrickring/kbuild/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+//runBuildGraph runs all builds in dependency order and prints a summary of every build afterwards
+func runBuildGraph(ctx context.Context, builds []config.Build, opts graph.Options) error {
+	logrus.Infof("Running %d builds with a parallelism of %d", len(builds), opts.Parallelism)
+
+	nodes := make([]graph.Node, 0, len(builds))
+	for _, build := range builds {
+		build := build
+		nodes = append(nodes, graph.Node{
+			Name:      build.Name,
+			DependsOn: build.DependsOn,
+			Run: func(ctx context.Context) error {
+				log := logrus.WithField("build", build.Name)
+				ctx = util.WithLogger(ctx, log)
+
+				out := &util.PrefixWriter{
+					Prefix: fmt.Sprintf("[%s] ", build.Name),
+					Out:    os.Stdout,
+				}
+				defer out.Flush()
+
+				err := runBuild(ctx, build, out)
+				if err != nil {
+					log.Errorf(`Build "%s" failed: %s`, build.Name, err)
+				}
+				return err
+			},
+		})
+	}
+
+	results, err := graph.Execute(ctx, nodes, opts)
+	if err != nil {
+		return err
+	}
+
+	printSummary(results)
+
+	for _, result := range results {
+		if result.Status == graph.StatusFailed || result.Status == graph.StatusCancelled {
+			return errors.Wrapf(result.Err, `build "%s"`, result.Name)
+		}
+	}
+	return nil
+}
+
+func printSummary(results []graph.Result) {
+	fmt.Println()
+	fmt.Println("Build summary:")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for _, result := range results {
+		duration := ""
+		if result.Duration > 0 {
+			duration = result.Duration.Round(time.Second).String()
+		}
+
+		message := ""
+		if result.Err != nil {
+			message = result.Err.Error()
+		}
+
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", result.Name, result.Status, duration, message)
+	}
+	_ = w.Flush()
+}
@@ -18,17 +18,20 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strings"
 	"syscall"
 
+	"github.com/cedrickring/kbuild/pkg/config"
 	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/cedrickring/kbuild/pkg/docker"
 	"github.com/cedrickring/kbuild/pkg/kaniko"
 	"github.com/cedrickring/kbuild/pkg/kaniko/source"
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/cedrickring/kbuild/pkg/patch"
+	"github.com/cedrickring/kbuild/pkg/util"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -36,16 +39,47 @@ import (
 )
 
 var (
-	dockerfile string
-	workingDir string
-	cacheRepo  string
-	namespace  string
-	imageTags  []string
-	buildArgs  []string
-	useCache   bool
-	username   string
-	password   string
-	gcsBucket  string
+	dockerfile     string
+	workingDir     string
+	cacheRepo      string
+	namespace      string
+	imageTags      []string
+	buildArgs      []string
+	buildArgFiles  []string
+	contextMode    string
+	useCache       bool
+	username       string
+	password       string
+	gcsBucket      string
+	configFile     string
+	buildNames     []string
+	registrySecret string
+
+	parallelism       int
+	continueOnFailure bool
+
+	kubeconfig  string
+	kubeContext string
+	podOverlay  string
+	dryRun      bool
+	output      string
+
+	timeouts kaniko.Timeouts
+	executor kaniko.ExecutorOptions
+
+	executorImage    string
+	initImage        string
+	imagePullSecrets []string
+
+	requests       map[string]string
+	limits         map[string]string
+	initRequests   map[string]string
+	initLimits     map[string]string
+	nodeSelector   map[string]string
+	tolerations    []string
+	affinity       string
+	priorityClass  string
+	serviceAccount string
 )
 
 func main() {
@@ -53,120 +87,223 @@ func main() {
 		Use:     "kbuild",
 		Example: "kbuild -t <repo>:<tag>",
 		Short:   "Build a container image inside a Kubernetes Cluster with Kaniko.",
+		Args:    cobra.MaximumNArgs(1), //optional build context source, e.g. "gcs"
 		Run:     run,
 	}
-	rootCmd.Flags().StringVarP(&dockerfile, "dockerfile", "d", "Dockerfile", "Path to Dockerfile inside working directory")
+	rootCmd.Flags().StringVarP(&dockerfile, "dockerfile", "d", "Dockerfile", "Path to the Dockerfile relative to the working directory, an absolute path or - to read it from stdin")
+	rootCmd.Flags().StringVarP(&dockerfile, "file", "f", "Dockerfile", "Alias of --dockerfile")
 	rootCmd.Flags().StringVarP(&workingDir, "workdir", "w", ".", "Working directory")
 	rootCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "The namespace to run the build in")
 	rootCmd.Flags().StringVarP(&cacheRepo, "cache-repo", "", "", "Repository for cached images (see --cache)")
 	rootCmd.Flags().StringVarP(&username, "username", "u", "", "Docker Registry username")
 	rootCmd.Flags().StringVarP(&password, "password", "p", "", "Docker Registry password")
-	rootCmd.Flags().StringSliceVarP(&imageTags, "tag", "t", nil, "Final image tag(s) (required)")
-	rootCmd.Flags().StringSliceVarP(&buildArgs, "build-arg", "", nil, "Optional build arguments (ARG)")
+	rootCmd.Flags().StringSliceVarP(&imageTags, "tag", "t", nil, "Final image tag(s) (required if not set in the config file)")
+	rootCmd.Flags().StringArrayVarP(&buildArgs, "build-arg", "", nil, "Optional build arguments (ARG) as KEY=VALUE or KEY to use the value of the environment (can be repeated)")
+	rootCmd.Flags().StringVarP(&contextMode, "context-mode", "", constants.ContextModeReferenced, "Files sent as build context, referenced (only files used by COPY and ADD) or full (the whole working directory filtered by .dockerignore)")
+	rootCmd.Flags().StringSliceVarP(&buildArgFiles, "build-arg-file", "", nil, "Path(s) to files with build arguments in dotenv format, overridden by --build-arg")
 	rootCmd.Flags().BoolVarP(&useCache, "cache", "c", false, "Enable RUN command caching")
 	rootCmd.Flags().StringVarP(&gcsBucket, "bucket", "b", "", "The bucket to upload the context to")
-	_ = rootCmd.MarkFlagRequired("tag")
+	rootCmd.Flags().StringVarP(&configFile, "config", "", "", "Path to the config file (defaults to kbuild.yaml in the working directory)")
+	rootCmd.Flags().StringSliceVarP(&buildNames, "build", "", nil, "Name(s) of the builds in the config file to run (defaults to all)")
+	rootCmd.Flags().StringVarP(&registrySecret, "registry-secret", "", "", "Name of an existing kubernetes.io/dockerconfigjson secret to use instead of the local credentials")
+	rootCmd.PersistentFlags().StringVarP(&kubeconfig, "kubeconfig", "", "", "Path to the kubeconfig file (defaults to $KUBECONFIG or ~/.kube/config)")
+	rootCmd.PersistentFlags().StringVarP(&kubeContext, "context", "", "", "The kubeconfig context to use (defaults to the current context)")
+	rootCmd.Flags().IntVarP(&parallelism, "parallelism", "", 1, "Max number of builds running at the same time")
+	rootCmd.Flags().BoolVarP(&continueOnFailure, "continue-on-failure", "", false, "Run builds even if one of their dependencies failed")
+	rootCmd.Flags().DurationVarP(&timeouts.Total, "timeout", "", 0, "Max duration of a build, e.g. 30m (0 disables the timeout)")
+	rootCmd.Flags().DurationVarP(&timeouts.Context, "context-timeout", "", 0, "Max duration of packaging the build context")
+	rootCmd.Flags().DurationVarP(&timeouts.Upload, "upload-timeout", "", 0, "Max duration of uploading the build context")
+	rootCmd.Flags().DurationVarP(&timeouts.PodStart, "pod-start-timeout", "", 0, "Max duration of waiting for the build pod to start")
+	rootCmd.Flags().DurationVarP(&timeouts.Build, "build-timeout", "", 0, "Max duration of the Kaniko build")
+	rootCmd.Flags().DurationVarP(&timeouts.Cleanup, "cleanup-timeout", "", kaniko.DefaultCleanupTimeout, "Max duration of deleting the resources of a build after it finished or was cancelled")
+	rootCmd.Flags().StringVarP(&executor.Target, "target", "", "", "The stage of a multi-stage Dockerfile to build")
+	rootCmd.Flags().StringVarP(&executor.SnapshotMode, "snapshot-mode", "", "", "Snapshot mode of Kaniko (full, time or redo)")
+	rootCmd.Flags().BoolVarP(&executor.SingleSnapshot, "single-snapshot", "", false, "Take a single snapshot of the filesystem at the end of the build")
+	rootCmd.Flags().BoolVarP(&executor.Reproducible, "reproducible", "", false, "Strip timestamps out of the image to make it reproducible")
+	rootCmd.Flags().DurationVarP(&executor.CacheTTL, "cache-ttl", "", 0, "Expiration of cached layers, e.g. 6h (see --cache)")
+	rootCmd.Flags().BoolVarP(&executor.Insecure, "insecure", "", false, "Push to insecure registries using plain HTTP")
+	rootCmd.Flags().BoolVarP(&executor.SkipTLSVerify, "skip-tls-verify", "", false, "Push to registries without TLS verification")
+	rootCmd.Flags().StringVarP(&executor.RegistryMirror, "registry-mirror", "", "", "Registry mirror to use instead of index.docker.io")
+	rootCmd.Flags().StringToStringVarP(&executor.Labels, "label", "", nil, "Labels added to the image, e.g. version=1.0")
+	rootCmd.Flags().BoolVarP(&executor.NoPush, "no-push", "", false, "Build the image without pushing it")
+	rootCmd.Flags().StringVarP(&executor.TarPath, "tar-path", "", "", "Path inside the Kaniko container to save the image as tarball at")
+	rootCmd.Flags().StringVarP(&executor.DigestFile, "digest-file", "", "", "Path inside the Kaniko container to write the image digest to")
+	rootCmd.Flags().BoolVarP(&executor.UseNewRun, "use-new-run", "", false, "Use the experimental run implementation of Kaniko")
+	rootCmd.Flags().StringArrayVarP(&executor.ExtraArgs, "kaniko-arg", "", nil, "Additional Kaniko executor flag, e.g. --kaniko-arg=--verbosity=debug (can be repeated)")
+	rootCmd.Flags().StringVarP(&executorImage, "executor-image", "", "", fmt.Sprintf("Kaniko executor image, pin it by tag or digest (default %s)", constants.DefaultExecutorImage))
+	rootCmd.Flags().StringVarP(&initImage, "init-image", "", "", fmt.Sprintf("Image of the init container the build context is copied into (default %s)", constants.DefaultInitImage))
+	rootCmd.Flags().StringSliceVarP(&imagePullSecrets, "image-pull-secret", "", nil, "Name(s) of secrets used to pull the executor and init images")
+	rootCmd.Flags().StringToStringVarP(&requests, "requests", "", nil, "Resource requests of the Kaniko container, e.g. cpu=1,memory=2Gi")
+	rootCmd.Flags().StringToStringVarP(&limits, "limits", "", nil, "Resource limits of the Kaniko container, e.g. cpu=2,memory=4Gi")
+	rootCmd.Flags().StringToStringVarP(&initRequests, "init-requests", "", nil, "Resource requests of the init container")
+	rootCmd.Flags().StringToStringVarP(&initLimits, "init-limits", "", nil, "Resource limits of the init container")
+	rootCmd.Flags().StringToStringVarP(&nodeSelector, "node-selector", "", nil, "Node labels the build pod has to be scheduled on, e.g. pool=builds")
+	rootCmd.Flags().StringSliceVarP(&tolerations, "toleration", "", nil, "Taints the build pod tolerates in the format key[=value][:effect], e.g. dedicated=builds:NoSchedule")
+	rootCmd.Flags().StringVarP(&affinity, "affinity", "", "", "Affinity of the build pod as yaml or json")
+	rootCmd.Flags().StringVarP(&priorityClass, "priority-class", "", "", "Name of the priority class of the build pod")
+	rootCmd.Flags().StringVarP(&serviceAccount, "service-account", "", "", "Name of the service account the build pod runs as")
+	rootCmd.Flags().StringVarP(&podOverlay, "pod-overlay", "", "", "Path to a strategic merge or json patch applied to the build pod")
+	rootCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Print the build plans instead of running the builds")
+	rootCmd.Flags().StringVarP(&output, "output", "o", outputYAML, "Output format of --dry-run (yaml or json)")
+
+	rootCmd.AddCommand(gcCommand())
+	rootCmd.AddCommand(contextCommand())
 
 	_ = rootCmd.Execute()
 }
 
-func run(_ *cobra.Command, args []string) {
+func run(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	catchCtrlC(cancel)
+	defer removeStdinDockerfile()
 
 	setupLogrus()
 
-	if err := validateImageTags(); err != nil {
+	if dryRun {
+		logrus.SetOutput(os.Stderr) //keep stdout clean for the plans
+	}
+
+	builds, opts, err := resolveBuilds(cmd, args)
+	if err != nil {
 		logrus.Fatal(err)
 		return
 	}
 
-	if err := checkForDockerfile(); err != nil {
-		logrus.Fatal(err)
+	if dryRun {
+		if err := printPlans(builds, output, os.Stdout); err != nil {
+			logrus.Fatal(err)
+		}
 		return
 	}
 
-	credentialsMap, err := getCredentialsConfigMap()
+	kubernetes.Configure(kubeconfig, kubeContext)
+	cluster, err := kubernetes.DescribeConfig()
 	if err != nil {
 		logrus.Fatal(err)
 		return
 	}
+	logrus.Infof("Using %s", cluster)
 
-	var ctxSource source.Source
-	if len(args) > 0 {
-		switch strings.ToLower(args[0]) {
-		case constants.GCSArgument:
-			if gcsBucket == "" {
-				logrus.Fatal("Please provide a bucket name via --bucket when using gcs")
-				return
-			}
-			logrus.Infoln("Using gcs build context source")
-			ctxSource = &source.GCS{
-				Ctx:       ctx,
-				Namespace: namespace,
-				Bucket:    gcsBucket,
-			}
-		default:
-			logrus.Infoln("Using local build context source")
-			ctxSource = source.Local{
-				Namespace: namespace,
-				Ctx:       ctx,
-			}
+	if len(builds) == 1 {
+		if err := runBuild(ctx, builds[0], os.Stdout); err != nil {
+			exitWithError(err)
 		}
-	} else { //otherwise default to local build context
-		logrus.Infoln("Using local build context source")
-		ctxSource = source.Local{
-			Namespace: namespace,
-			Ctx:       ctx,
+		return
+	}
+
+	if err := runBuildGraph(ctx, builds, opts); err != nil {
+		exitWithError(err)
+	}
+}
+
+func runBuild(ctx context.Context, build config.Build, out io.Writer) error {
+	log := util.Logger(ctx)
+	if build.Name != "" {
+		log.Infof(`Starting build "%s"`, build.Name)
+	}
+
+	b, err := newKanikoBuild(log, build)
+	if err != nil {
+		return err
+	}
+	b.Out = out
+
+	if build.RegistrySecret != "" {
+		log.Infof(`Using existing registry secret "%s"`, build.RegistrySecret)
+	} else {
+		secret, err := getCredentialsSecret(log, build)
+		if err != nil {
+			return err
 		}
+		b.CredentialsSecret = secret
 	}
 
 	cachingInfo := "Run-Step caching is %s."
-	if useCache {
-		logrus.Infof(cachingInfo, "enabled")
+	if build.Cache {
+		log.Infof(cachingInfo, "enabled")
 	} else {
-		logrus.Infof(cachingInfo, "disabled")
+		log.Infof(cachingInfo, "disabled")
 	}
 
-	logrus.Infof(`Running in namespace "%s"`, namespace)
+	log.Infof(`Running in namespace "%s"`, build.Namespace)
 
-	b := kaniko.Build{
-		DockerfilePath: dockerfile,
-		WorkDir:        workingDir,
-		ImageTags:      imageTags,
-		Cache:          useCache,
-		CacheRepo:      cacheRepo,
-		Namespace:      namespace,
-		BuildArgs:      buildArgs,
-		CredentialsMap: credentialsMap,
-		Source:         ctxSource,
+	result, err := b.StartBuild(ctx)
+	if result != nil && err != nil {
+		log.Errorf("Build container terminated after %s with exit code %d (%s)", result.Duration(), result.ExitCode, result.Reason)
 	}
-	err = b.StartBuild(ctx)
+	return err
+}
+
+//newKanikoBuild creates the Kaniko build for the build options, without registry credentials
+func newKanikoBuild(log *logrus.Entry, build config.Build) (kaniko.Build, error) {
+	buildTimeouts, err := parseTimeouts(build.Timeouts)
 	if err != nil {
-		if err == kaniko.ErrorBuildFailed {
-			logrus.Fatal("Build failed.")
-		} else {
-			logrus.Fatal(err)
-		}
+		return kaniko.Build{}, err
 	}
-}
 
-func validateImageTags() error {
-	for _, tag := range imageTags {
-		_, err := name.NewTag(tag, name.WeakValidation) //weak validation to allow only <registry/<repo> without a specific tag
+	var overlay *patch.Patch
+	if build.PodOverlay != "" {
+		overlay, err = patch.Load(build.PodOverlay)
 		if err != nil {
-			return err
+			return kaniko.Build{}, err
+		}
+		log.Infof("Using %s pod overlay %s", overlay.Type, build.PodOverlay)
+	}
+
+	var ctxSource source.Source
+	switch build.Source {
+	case constants.GCSArgument:
+		log.Infoln("Using gcs build context source")
+		ctxSource = &source.GCS{
+			Namespace: build.Namespace,
+			Bucket:    build.Bucket,
+		}
+	default: //otherwise default to local build context
+		log.Infoln("Using local build context source")
+		ctxSource = source.Local{
+			Namespace: build.Namespace,
 		}
 	}
-	return nil
-}
 
-func checkForDockerfile() error {
-	if _, err := os.Stat(filepath.Join(workingDir, dockerfile)); err != nil {
-		return errors.Errorf("Can't find Dockerfile in the working directory. (%s/%s)", workingDir, dockerfile)
+	executorOpts, err := executorOptions(build.Kaniko)
+	if err != nil {
+		return kaniko.Build{}, err
 	}
-	return nil
+
+	pod := podOptions(build.Pod)
+	for _, image := range []string{pod.ExecutorImage, pod.InitImage} {
+		if image == "" {
+			continue
+		}
+
+		pinned, err := docker.IsPinned(image)
+		if err != nil {
+			return kaniko.Build{}, err
+		}
+		if !pinned {
+			log.Warnf("Image %s is not pinned to a tag or digest, the build might not be reproducible", image)
+		}
+	}
+
+	return kaniko.Build{
+		Name:              build.Name,
+		DockerfilePath:    build.Dockerfile,
+		ContextMode:       build.ContextMode,
+		WorkDir:           build.WorkDir,
+		ImageTags:         build.Tags,
+		Cache:             build.Cache,
+		CacheRepo:         build.CacheRepo,
+		Namespace:         build.Namespace,
+		BuildArgs:         build.BuildArgs,
+		RedactedBuildArgs: build.RedactedBuildArgs,
+		RegistrySecret:    build.RegistrySecret,
+		Source:            ctxSource,
+		Timeouts:          buildTimeouts,
+		Pod:               pod,
+		PodOverlay:        overlay,
+		Executor:          executorOpts,
+	}, nil
 }
 
 func setupLogrus() {
@@ -176,35 +313,63 @@ func setupLogrus() {
 	logrus.SetOutput(os.Stdout)
 }
 
+//catchCtrlC cancels the builds on the first signal, so they can delete their resources in the cluster,
+//and exits immediately on the second signal
 func catchCtrlC(cancel context.CancelFunc) {
-	signals := make(chan os.Signal, 1)
+	signals := make(chan os.Signal, 2)
 	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGPIPE)
 	go func() {
 		<-signals
+		logrus.Warn("Cancelling build and cleaning up, press Ctrl-C again to force quit")
 		cancel()
+
+		<-signals
+		logrus.Warn("Force quit, resources of the build might be left behind in the cluster")
+		os.Exit(exitCancelled)
 	}()
 }
 
-func getCredentialsConfigMap() (*v1.ConfigMap, error) {
+func getCredentialsSecret(log *logrus.Entry, build config.Build) (*v1.Secret, error) {
 	var credentials []byte
 
 	//check if credentials have been provided by flags
 	if username != "" && password != "" {
-		logrus.Infoln("Using credentials from flags")
-		registry := docker.GuessRegistryFromTag(imageTags[0])
+		log.Infoln("Using credentials from flags")
+		registry := docker.GuessRegistryFromTag(build.Tags[0])
 		creds, err := docker.GetCredentialsFromFlags(username, password, registry)
 		if err != nil {
 			return nil, errors.Wrap(err, "getting credentials from flags")
 		}
 		credentials = creds
 	} else { //otherwise read ~/.docker/config.json
-		logrus.Infoln("Using credentials from ~/.docker/config.json")
-		creds, err := docker.GetCredentialsFromConfig()
+		log.Infoln("Using credentials from ~/.docker/config.json")
+		registries, err := referencedRegistries(build)
+		if err != nil {
+			return nil, err
+		}
+
+		creds, err := docker.GetCredentialsFromConfig(registries)
 		if err != nil {
 			return nil, errors.Wrap(err, "getting credentials from config")
 		}
 		credentials = creds
 	}
 
-	return docker.GetCredentialsAsConfigMap(credentials), nil
+	return docker.GetCredentialsAsSecret(credentials), nil
+}
+
+//referencedRegistries returns all registries the build pushes to or pulls from
+func referencedRegistries(build config.Build) ([]string, error) {
+	images := append([]string{}, build.Tags...)
+	if build.CacheRepo != "" {
+		images = append(images, build.CacheRepo)
+	}
+
+	baseImages, err := docker.GetBaseImages(build.WorkDir, build.Dockerfile, build.BuildArgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting base images")
+	}
+	images = append(images, baseImages...)
+
+	return docker.GetRegistries(images), nil
 }
@@ -0,0 +1,388 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/graph"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+//APIVersion is the currently supported version of the kbuild.yaml schema
+const APIVersion = "kbuild/v1alpha1"
+
+//Config represents the contents of a kbuild.yaml file
+type Config struct {
+	APIVersion        string  `json:"apiVersion"`
+	Namespace         string  `json:"namespace,omitempty"`
+	Parallelism       int     `json:"parallelism,omitempty"`
+	ContinueOnFailure bool    `json:"continueOnFailure,omitempty"`
+	Builds            []Build `json:"builds"`
+}
+
+//Build contains the configuration of a single named build target
+type Build struct {
+	Name       string   `json:"name"`
+	Dockerfile string   `json:"dockerfile,omitempty"`
+	WorkDir    string   `json:"workdir,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	BuildArgs  []string `json:"buildArgs,omitempty"`
+	Cache      bool     `json:"cache,omitempty"`
+	CacheRepo  string   `json:"cacheRepo,omitempty"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Bucket     string   `json:"bucket,omitempty"`
+	DependsOn  []string `json:"dependsOn,omitempty"`
+
+	//BuildArgFiles are paths to dotenv files with build args, which are overridden by BuildArgs
+	BuildArgFiles  []string `json:"buildArgFiles,omitempty"`
+	RegistrySecret string   `json:"registrySecret,omitempty"`
+	//ContextMode is either "referenced" (default) or "full", see constants.ContextModeReferenced and constants.ContextModeFull
+	ContextMode string `json:"contextMode,omitempty"`
+
+	Timeouts Timeouts `json:"timeouts,omitempty"`
+	Pod      Pod      `json:"pod,omitempty"`
+	//PodOverlay is the path to a strategic merge or json patch applied to the build pod
+	PodOverlay string `json:"podOverlay,omitempty"`
+	Kaniko     Kaniko `json:"kaniko,omitempty"`
+
+	//RedactedBuildArgs are the keys of the resolved build args whose values were read from the environment or a dotenv file
+	RedactedBuildArgs []string `json:"-"`
+}
+
+//Timeouts contains the durations (e.g. "10m") a build and its phases may take at most
+type Timeouts struct {
+	Total    string `json:"total,omitempty"`
+	Context  string `json:"context,omitempty"`
+	Upload   string `json:"upload,omitempty"`
+	PodStart string `json:"podStart,omitempty"`
+	Build    string `json:"build,omitempty"`
+	Cleanup  string `json:"cleanup,omitempty"`
+}
+
+//fields returns all timeouts keyed by their name in the config file
+func (t Timeouts) fields() map[string]string {
+	return map[string]string{
+		"total":    t.Total,
+		"context":  t.Context,
+		"upload":   t.Upload,
+		"podStart": t.PodStart,
+		"build":    t.Build,
+		"cleanup":  t.Cleanup,
+	}
+}
+
+//FieldError is a validation error pointing at the offending key of the config file
+type FieldError struct {
+	Path   string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+//Load reads and validates the config file at the provided path.
+//Relative working directories, build arg files and pod overlays are resolved against the directory of the config file.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading config file")
+	}
+
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config file %s", path)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range cfg.Builds {
+		b := &cfg.Builds[i]
+		if b.WorkDir == "" {
+			b.WorkDir = dir
+		} else if !filepath.IsAbs(b.WorkDir) {
+			b.WorkDir = filepath.Join(dir, b.WorkDir)
+		}
+		for j, file := range b.BuildArgFiles {
+			if !filepath.IsAbs(file) {
+				b.BuildArgFiles[j] = filepath.Join(dir, file)
+			}
+		}
+		if b.PodOverlay != "" && !filepath.IsAbs(b.PodOverlay) {
+			b.PodOverlay = filepath.Join(dir, b.PodOverlay)
+		}
+	}
+
+	return cfg, nil
+}
+
+//Parse parses and validates the yaml encoded config
+func Parse(data []byte) (*Config, error) {
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing yaml")
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(js, &raw); err != nil {
+		return nil, errors.Wrap(err, "parsing yaml")
+	}
+	if err := checkKeys(raw, reflect.TypeOf(Config{}), ""); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(js, &cfg); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return nil, FieldError{
+				Path:   typeErr.Field,
+				Reason: fmt.Sprintf("expected %s but got %s", typeErr.Type, typeErr.Value),
+			}
+		}
+		return nil, errors.Wrap(err, "decoding config")
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+//Select returns the builds with the provided names in the order they were requested.
+//The builds they depend on are selected as well and precede them. All builds are returned if no names are provided.
+func (c Config) Select(names []string) ([]Build, error) {
+	if len(names) == 0 {
+		return c.Builds, nil
+	}
+
+	var builds []Build
+	selected := make(map[string]bool)
+
+	var selectBuild func(name, requiredBy string) error
+	selectBuild = func(name, requiredBy string) error {
+		if selected[name] {
+			return nil
+		}
+
+		build, ok := c.build(name)
+		if !ok {
+			if requiredBy != "" {
+				return errors.Errorf("build %q required by %q is not defined in the config file", name, requiredBy)
+			}
+			return errors.Errorf("build %q is not defined in the config file", name)
+		}
+		selected[name] = true
+
+		for _, dependency := range build.DependsOn {
+			if err := selectBuild(dependency, name); err != nil {
+				return err
+			}
+		}
+		builds = append(builds, build)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := selectBuild(name, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return builds, nil
+}
+
+func (c Config) build(name string) (Build, bool) {
+	for _, b := range c.Builds {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Build{}, false
+}
+
+func (c *Config) validate() error {
+	if c.APIVersion == "" {
+		return FieldError{Path: "apiVersion", Reason: "is required"}
+	}
+	if c.APIVersion != APIVersion {
+		return FieldError{Path: "apiVersion", Reason: fmt.Sprintf("unsupported version %q, expected %q", c.APIVersion, APIVersion)}
+	}
+
+	if c.Parallelism < 0 {
+		return FieldError{Path: "parallelism", Reason: "must not be negative"}
+	}
+
+	if len(c.Builds) == 0 {
+		return FieldError{Path: "builds", Reason: "at least one build is required"}
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Builds {
+		b := &c.Builds[i]
+		path := fmt.Sprintf("builds[%d]", i)
+
+		if b.Name == "" {
+			return FieldError{Path: path + ".name", Reason: "is required"}
+		}
+		if names[b.Name] {
+			return FieldError{Path: path + ".name", Reason: fmt.Sprintf("duplicate build name %q", b.Name)}
+		}
+		names[b.Name] = true
+
+		if b.Namespace == "" {
+			b.Namespace = c.Namespace
+		}
+
+		switch strings.ToLower(b.Source) {
+		case "", constants.LocalArgument, constants.GCSArgument:
+		default:
+			return FieldError{Path: path + ".source", Reason: fmt.Sprintf("unknown source %q, must be one of %s, %s", b.Source, constants.LocalArgument, constants.GCSArgument)}
+		}
+
+		switch b.ContextMode {
+		case "", constants.ContextModeReferenced, constants.ContextModeFull:
+		default:
+			return FieldError{Path: path + ".contextMode", Reason: fmt.Sprintf("unknown context mode %q, must be one of %s, %s", b.ContextMode, constants.ContextModeReferenced, constants.ContextModeFull)}
+		}
+
+		if err := validateTimeouts(b.Timeouts, path+".timeouts"); err != nil {
+			return err
+		}
+
+		if err := b.Pod.validate(path + ".pod"); err != nil {
+			return err
+		}
+
+		if err := b.Kaniko.validate(path + ".kaniko"); err != nil {
+			return err
+		}
+	}
+
+	nodes := make([]graph.Node, 0, len(c.Builds))
+	for i, b := range c.Builds {
+		for j, dep := range b.DependsOn {
+			if !names[dep] {
+				return FieldError{Path: fmt.Sprintf("builds[%d].dependsOn[%d]", i, j), Reason: fmt.Sprintf("unknown build %q", dep)}
+			}
+		}
+		nodes = append(nodes, graph.Node{Name: b.Name, DependsOn: b.DependsOn})
+	}
+
+	if err := graph.Validate(nodes); err != nil {
+		return FieldError{Path: "builds", Reason: err.Error()}
+	}
+
+	return nil
+}
+
+func validateTimeouts(t Timeouts, path string) error {
+	fields := t.fields()
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fields[key]
+		if value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return FieldError{Path: joinPath(path, key), Reason: fmt.Sprintf("invalid duration %q", value)}
+		}
+		if d < 0 {
+			return FieldError{Path: joinPath(path, key), Reason: "must not be negative"}
+		}
+	}
+	return nil
+}
+
+//checkKeys walks the decoded yaml and makes sure every key is known by the corresponding struct type
+func checkKeys(value interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return nil //maps and other types are validated when decoding
+		}
+
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, ok := fields[key]
+			if !ok {
+				return FieldError{Path: joinPath(path, key), Reason: "unknown key"}
+			}
+			if err := checkKeys(v[key], field.Type, joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, elem := range v {
+			if err := checkKeys(elem, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,282 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		config      string
+		expectedErr string
+	}{
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+namespace: builds
+builds:
+- name: app
+  tags: [registry.com/app:latest]
+  buildArgs: [VERSION=1.0]
+- name: worker
+  dockerfile: Dockerfile.worker
+  tags: [registry.com/worker:latest]
+  cache: true
+  dependsOn: [app]
+  timeouts:
+    total: 30m
+    build: 20m
+  pod:
+    executorImage: gcr.io/kaniko-project/executor@sha256:72c42ed48c3a2db31b7dafe17d275b634664a708d901ec9fd57b1529280f01fb
+    imagePullSecrets: [mirror]
+    resources:
+      requests: {cpu: 500m, memory: 1Gi}
+    nodeSelector: {pool: builds}
+    tolerations:
+    - {key: dedicated, operator: Equal, value: builds, effect: NoSchedule}
+    serviceAccountName: builder
+  kaniko:
+    target: release
+    snapshotMode: redo
+    cacheTTL: 6h
+    labels: {version: "1.0"}
+    args: [--verbosity=debug]
+`,
+		},
+		{
+			config: `
+builds:
+- name: app
+`,
+			expectedErr: "apiVersion: is required",
+		},
+		{
+			config: `
+apiVersion: kbuild/v2
+builds:
+- name: app
+`,
+			expectedErr: "apiVersion: unsupported version",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  tag: registry.com/app:latest
+`,
+			expectedErr: "builds[0].tag: unknown key",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+- name: app
+`,
+			expectedErr: `builds[1].name: duplicate build name "app"`,
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- tags: [registry.com/app:latest]
+`,
+			expectedErr: "builds[0].name: is required",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  source: s3
+`,
+			expectedErr: `builds[0].source: unknown source "s3"`,
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  dependsOn: [base]
+`,
+			expectedErr: `builds[0].dependsOn[0]: unknown build "base"`,
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  dependsOn: [base]
+- name: base
+  dependsOn: [app]
+`,
+			expectedErr: "builds: dependency cycle app -> base -> app",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds: []
+`,
+			expectedErr: "builds: at least one build is required",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  timeouts:
+    podStart: 5 minutes
+`,
+			expectedErr: `builds[0].timeouts.podStart: invalid duration "5 minutes"`,
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  timeouts:
+    start: 5m
+`,
+			expectedErr: "builds[0].timeouts.start: unknown key",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  pod:
+    tolerations:
+    - {key: dedicated, effect: Never}
+`,
+			expectedErr: `builds[0].pod.tolerations[0]: unknown effect "Never"`,
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  pod:
+    nodeSelectors: {pool: builds}
+`,
+			expectedErr: "builds[0].pod.nodeSelectors: unknown key",
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  pod:
+    initImage: Alpine:3.10
+`,
+			expectedErr: `builds[0].pod.initImage: invalid image reference "Alpine:3.10"`,
+		},
+		{
+			config: `
+apiVersion: kbuild/v1alpha1
+builds:
+- name: app
+  kaniko:
+    cacheTTL: 1 day
+`,
+			expectedErr: `builds[0].kaniko.cacheTTL: invalid duration "1 day"`,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Parse([]byte(test.config))
+		if test.expectedErr == "" {
+			if err != nil {
+				t.Errorf("Expected config to be valid but got error %s", err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("Expected error %s but got none", test.expectedErr)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("Expected error %s but got %s", test.expectedErr, err)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	cfg, err := Parse([]byte(`
+apiVersion: kbuild/v1alpha1
+namespace: builds
+builds:
+- name: app
+- name: worker
+  namespace: workers
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builds, err := cfg.Select([]string{"worker", "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(builds) != 2 || builds[0].Name != "worker" || builds[1].Name != "app" {
+		t.Errorf("Expected builds worker and app but got %v", builds)
+	}
+
+	if builds[0].Namespace != "workers" || builds[1].Namespace != "builds" {
+		t.Errorf("Expected namespaces workers and builds but got %s and %s", builds[0].Namespace, builds[1].Namespace)
+	}
+
+	if _, err := cfg.Select([]string{"missing"}); err == nil {
+		t.Error("Expected error for unknown build but got none")
+	}
+}
+
+func TestSelectDependencies(t *testing.T) {
+	cfg, err := Parse([]byte(`
+apiVersion: kbuild/v1alpha1
+builds:
+- name: base
+- name: runtime
+  dependsOn: [base]
+- name: app
+  dependsOn: [runtime, base]
+- name: docs
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builds, err := cfg.Select([]string{"app", "runtime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, build := range builds {
+		names = append(names, build.Name)
+	}
+	expected := []string{"base", "runtime", "app"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected builds %v but got %v", expected, names)
+	}
+}
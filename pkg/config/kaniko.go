@@ -0,0 +1,56 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+//Kaniko contains the flags passed to the Kaniko executor
+type Kaniko struct {
+	Target         string            `json:"target,omitempty"`
+	SnapshotMode   string            `json:"snapshotMode,omitempty"`
+	SingleSnapshot bool              `json:"singleSnapshot,omitempty"`
+	Reproducible   bool              `json:"reproducible,omitempty"`
+	CacheTTL       string            `json:"cacheTTL,omitempty"`
+	Insecure       bool              `json:"insecure,omitempty"`
+	SkipTLSVerify  bool              `json:"skipTLSVerify,omitempty"`
+	RegistryMirror string            `json:"registryMirror,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	NoPush         bool              `json:"noPush,omitempty"`
+	TarPath        string            `json:"tarPath,omitempty"`
+	DigestFile     string            `json:"digestFile,omitempty"`
+	UseNewRun      bool              `json:"useNewRun,omitempty"`
+	//Args are passed to the executor as is, e.g. --verbosity=debug
+	Args []string `json:"args,omitempty"`
+}
+
+func (k Kaniko) validate(path string) error {
+	if k.CacheTTL == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(k.CacheTTL)
+	if err != nil {
+		return FieldError{Path: path + ".cacheTTL", Reason: fmt.Sprintf("invalid duration %q", k.CacheTTL)}
+	}
+	if d < 0 {
+		return FieldError{Path: path + ".cacheTTL", Reason: "must not be negative"}
+	}
+	return nil
+}
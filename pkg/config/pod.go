@@ -0,0 +1,149 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+//Pod contains the images, resources and scheduling constraints of the build pod
+type Pod struct {
+	ExecutorImage      string                  `json:"executorImage,omitempty"`
+	InitImage          string                  `json:"initImage,omitempty"`
+	ImagePullSecrets   []string                `json:"imagePullSecrets,omitempty"`
+	Resources          v1.ResourceRequirements `json:"resources,omitempty"`
+	InitResources      v1.ResourceRequirements `json:"initResources,omitempty"`
+	NodeSelector       map[string]string       `json:"nodeSelector,omitempty"`
+	Tolerations        []v1.Toleration         `json:"tolerations,omitempty"`
+	Affinity           *v1.Affinity            `json:"affinity,omitempty"`
+	PriorityClassName  string                  `json:"priorityClassName,omitempty"`
+	ServiceAccountName string                  `json:"serviceAccountName,omitempty"`
+}
+
+//ParseResourceList parses resource quantities like cpu=500m or memory=2Gi
+func ParseResourceList(values map[string]string) (v1.ResourceList, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	list := make(v1.ResourceList, len(values))
+	for name, value := range values {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, errors.Errorf("invalid quantity %q for resource %s", value, name)
+		}
+		list[v1.ResourceName(name)] = quantity
+	}
+	return list, nil
+}
+
+//ParseToleration parses a toleration in the format of a taint, e.g. key=value:NoSchedule.
+//The value and the effect are optional, a toleration without value tolerates all values of the key.
+func ParseToleration(value string) (v1.Toleration, error) {
+	var toleration v1.Toleration
+
+	keyValue := value
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		keyValue = value[:i]
+		toleration.Effect = v1.TaintEffect(value[i+1:])
+	}
+
+	if i := strings.Index(keyValue, "="); i >= 0 {
+		toleration.Key = keyValue[:i]
+		toleration.Value = keyValue[i+1:]
+		toleration.Operator = v1.TolerationOpEqual
+	} else {
+		toleration.Key = keyValue
+		toleration.Operator = v1.TolerationOpExists
+	}
+
+	if toleration.Key == "" {
+		return toleration, errors.Errorf("invalid toleration %q, expected key[=value][:effect]", value)
+	}
+	if err := validateToleration(toleration); err != nil {
+		return toleration, errors.Wrapf(err, "invalid toleration %q", value)
+	}
+
+	return toleration, nil
+}
+
+//ParseAffinity parses the yaml or json encoded affinity of the build pod
+func ParseAffinity(value string) (*v1.Affinity, error) {
+	var affinity v1.Affinity
+	if err := yaml.UnmarshalStrict([]byte(value), &affinity); err != nil {
+		return nil, errors.Wrap(err, "parsing affinity")
+	}
+	return &affinity, nil
+}
+
+func (p Pod) validate(path string) error {
+	images := []struct {
+		field string
+		image string
+	}{
+		{"executorImage", p.ExecutorImage},
+		{"initImage", p.InitImage},
+	}
+	for _, i := range images {
+		if i.image == "" {
+			continue
+		}
+		if _, err := name.ParseReference(i.image, name.WeakValidation); err != nil {
+			return FieldError{Path: fmt.Sprintf("%s.%s", path, i.field), Reason: fmt.Sprintf("invalid image reference %q", i.image)}
+		}
+	}
+
+	for i, secret := range p.ImagePullSecrets {
+		if secret == "" {
+			return FieldError{Path: fmt.Sprintf("%s.imagePullSecrets[%d]", path, i), Reason: "must not be empty"}
+		}
+	}
+
+	for i, toleration := range p.Tolerations {
+		if err := validateToleration(toleration); err != nil {
+			return FieldError{Path: fmt.Sprintf("%s.tolerations[%d]", path, i), Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func validateToleration(toleration v1.Toleration) error {
+	switch toleration.Effect {
+	case "", v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		return errors.Errorf("unknown effect %q, must be one of %s, %s, %s", toleration.Effect, v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute)
+	}
+
+	switch toleration.Operator {
+	case "", v1.TolerationOpEqual:
+	case v1.TolerationOpExists:
+		if toleration.Value != "" {
+			return errors.New("value must be empty when the operator is Exists")
+		}
+	default:
+		return errors.Errorf("unknown operator %q, must be one of %s, %s", toleration.Operator, v1.TolerationOpEqual, v1.TolerationOpExists)
+	}
+
+	return nil
+}
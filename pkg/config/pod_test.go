@@ -0,0 +1,88 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseToleration(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    v1.Toleration
+		expectError bool
+	}{
+		{
+			value:    "dedicated=builds:NoSchedule",
+			expected: v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "builds", Effect: v1.TaintEffectNoSchedule},
+		},
+		{
+			value:    "dedicated:NoExecute",
+			expected: v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute},
+		},
+		{
+			value:    "dedicated=builds",
+			expected: v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "builds"},
+		},
+		{
+			value:       "dedicated=builds:Never",
+			expectError: true,
+		},
+		{
+			value:       ":NoSchedule",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		toleration, err := ParseToleration(test.value)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Expected error for %s but got none", test.value)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected no error for %s but got %s", test.value, err)
+			continue
+		}
+		if toleration != test.expected {
+			t.Errorf("Expected %+v but got %+v", test.expected, toleration)
+		}
+	}
+}
+
+func TestParseResourceList(t *testing.T) {
+	list, err := ParseResourceList(map[string]string{"cpu": "500m", "memory": "2Gi"})
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	if cpu := list[v1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("Expected cpu 500m but got %s", cpu.String())
+	}
+	if memory := list[v1.ResourceMemory]; memory.String() != "2Gi" {
+		t.Errorf("Expected memory 2Gi but got %s", memory.String())
+	}
+
+	if _, err := ParseResourceList(map[string]string{"memory": "two gigs"}); err == nil {
+		t.Error("Expected error for invalid quantity but got none")
+	}
+}
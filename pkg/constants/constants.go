@@ -18,8 +18,21 @@ package constants
 
 //Constants to be used in all packages
 const (
-	ConfigMapName          = "kaniko-configmap"
+	CredentialsSecretName  = "kaniko-credentials"
 	KanikoBuildContextPath = "/kaniko/build-context"
 	KanikoContainerName    = "kaniko-build"
 	GCSArgument            = "gcs"
+	LocalArgument          = "local"
+	ConfigFileName         = "kbuild.yaml"
+	BuilderLabel           = "builder"
+	BuildIDLabel           = "kbuild/build-id"
+	BuildNameAnnotation    = "kbuild/build-name"
+	CreatedByAnnotation    = "kbuild/created-by"
+	BuildIDMetadataKey     = "kbuild-build-id"
+	ContextObjectPrefix    = "context-"
+	DefaultExecutorImage   = "gcr.io/kaniko-project/executor:v1.6.0" //oldest release supporting every flag kbuild passes to the executor
+	DefaultInitImage       = "alpine:3.10"
+	InjectedDockerfile     = ".kbuild.Dockerfile" //reserved name of a Dockerfile outside of the work dir in the build context
+	ContextModeReferenced  = "referenced"         //only send the files referenced by COPY and ADD instructions
+	ContextModeFull        = "full"               //send the whole work dir filtered by the .dockerignore
 )
@@ -0,0 +1,146 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//ResolveBuildArgs returns the build args of the dotenv files followed by the build args of the flags as KEY=VALUE,
+//a build arg overrides the values of previous files and flags with the same key.
+//Build args without value (KEY) take the value of the local environment and are omitted if it's not set, like `docker build` does.
+//The keys of all build args whose values were read from the environment or a dotenv file are returned as well,
+//as they may contain secrets their values shouldn't be printed.
+func ResolveBuildArgs(files, buildArgs []string) ([]string, []string, error) {
+	var keys []string
+	values := make(map[string]string)
+	external := make(map[string]bool)
+	set := func(key, value string, fromEnv bool) {
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+		external[key] = fromEnv
+	}
+
+	for _, file := range files {
+		args, err := readBuildArgFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, arg := range args {
+			set(arg[0], arg[1], true)
+		}
+	}
+
+	for _, arg := range buildArgs {
+		if !strings.Contains(arg, "=") {
+			if value, ok := os.LookupEnv(arg); ok {
+				set(arg, value, true)
+			}
+			continue
+		}
+
+		key, value, err := parseArg(arg)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "parsing build arg %q", arg)
+		}
+		set(key, value, false)
+	}
+
+	resolved := make([]string, 0, len(keys))
+	var redact []string
+	for _, key := range keys {
+		resolved = append(resolved, fmt.Sprintf("%s=%s", key, values[key]))
+		if external[key] {
+			redact = append(redact, key)
+		}
+	}
+	return resolved, redact, nil
+}
+
+//readBuildArgFile reads the key value pairs of a dotenv file. Empty lines and lines starting with # are ignored,
+//values may be quoted and keys without value take the value of the local environment.
+func readBuildArgFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening build arg file")
+	}
+	defer f.Close()
+
+	var args [][2]string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		split := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(split[0])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, errors.Errorf("%s:%d: invalid key %q", path, line, key)
+		}
+
+		if len(split) == 1 {
+			if value, ok := os.LookupEnv(key); ok {
+				args = append(args, [2]string{key, value})
+			}
+			continue
+		}
+
+		value, err := parseDotenvValue(strings.TrimSpace(split[1]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", path, line)
+		}
+		args = append(args, [2]string{key, value})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading build arg file")
+	}
+	return args, nil
+}
+
+//parseDotenvValue unquotes a value, escape sequences are only supported in double quotes.
+//Unquoted values end at a comment starting with " #".
+func parseDotenvValue(value string) (string, error) {
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", errors.Errorf("invalid quoted value %s", value)
+		}
+		return unquoted, nil
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1], nil
+	case strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'"):
+		return "", errors.Errorf("unterminated quoted value %s", value)
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
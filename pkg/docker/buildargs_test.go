@@ -0,0 +1,94 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestResolveBuildArgs(t *testing.T) {
+	os.Setenv("FROM_ENV", "env")
+	os.Setenv("KEY_FROM_ENV", "key=env")
+	os.Unsetenv("NOT_IN_ENV")
+	defer os.Unsetenv("FROM_ENV")
+	defer os.Unsetenv("KEY_FROM_ENV")
+
+	var tests = []struct {
+		files     []string
+		buildArgs []string
+		expected  []string
+		redact    []string
+		shouldErr bool
+	}{
+		{
+			files: []string{"test/build-args.env"},
+			expected: []string{
+				"VERSION=1.0", "TARGET=release", `QUOTED=a "quoted" value`, "SINGLE=no $expansion",
+				"COMMENT=value", "EMPTY=", "FROM_ENV=env",
+			},
+			redact: []string{"VERSION", "TARGET", "QUOTED", "SINGLE", "COMMENT", "EMPTY", "FROM_ENV"},
+		},
+		{
+			files:     []string{"test/build-args.env"},
+			buildArgs: []string{"VERSION=2.0", "KEY_FROM_ENV", "NOT_IN_ENV", "A=b=c"},
+			expected: []string{
+				"VERSION=2.0", "TARGET=release", `QUOTED=a "quoted" value`, "SINGLE=no $expansion",
+				"COMMENT=value", "EMPTY=", "FROM_ENV=env", "KEY_FROM_ENV=key=env", "A=b=c",
+			},
+			redact: []string{"TARGET", "QUOTED", "SINGLE", "COMMENT", "EMPTY", "FROM_ENV", "KEY_FROM_ENV"},
+		},
+		{
+			buildArgs: []string{"=value"},
+			shouldErr: true,
+		},
+		{
+			files:     []string{"test/missing.env"},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		args, redact, err := ResolveBuildArgs(test.files, test.buildArgs)
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Expected no error but got %s", err)
+			}
+			continue
+		}
+		if test.shouldErr {
+			t.Errorf("Expected an error for %v but got none", test.buildArgs)
+			continue
+		}
+
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("Expected %v but got %v", test.expected, args)
+		}
+		if !reflect.DeepEqual(redact, test.redact) {
+			t.Errorf("Expected redacted keys %v but got %v", test.redact, redact)
+		}
+	}
+}
+
+func TestParseDotenvValue(t *testing.T) {
+	for _, value := range []string{`"unterminated`, `'unterminated`, `"invalid \q"`} {
+		if _, err := parseDotenvValue(value); err == nil {
+			t.Errorf("Expected an error for %s but got none", value)
+		}
+	}
+}
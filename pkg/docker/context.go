@@ -24,32 +24,155 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/docker/docker/builder/dockerignore"
 	"github.com/docker/docker/pkg/fileutils"
 	"github.com/pkg/errors"
 )
 
-//CreateContextFromWorkingDir creates a build context of the provided directory and writes it to the Writer
-func CreateContextFromWorkingDir(workDir, dockerfile string, w io.Writer, buildArgs []string) error {
+//ContextStats contains the number of files of a build context and their uncompressed size in bytes
+type ContextStats struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+}
+
+//ValidateContextMode returns an error if the mode isn't a build context mode, an empty mode defaults to constants.ContextModeReferenced
+func ValidateContextMode(mode string) error {
+	switch mode {
+	case "", constants.ContextModeReferenced, constants.ContextModeFull:
+		return nil
+	}
+	return errors.Errorf("unknown context mode %q, must be %s or %s", mode, constants.ContextModeReferenced, constants.ContextModeFull)
+}
+
+//GetContextPaths returns the paths sent as build context in the mode, directories are included recursively.
+//In the full context mode the work dir is returned, otherwise the paths referenced by the Dockerfile (see GetFilePaths).
+func GetContextPaths(workDir, dockerfile, target, mode string, buildArgs []string) ([]string, error) {
+	if err := ValidateContextMode(mode); err != nil {
+		return nil, err
+	}
+	if mode == constants.ContextModeFull {
+		return []string{workDir}, nil
+	}
+	return GetFilePaths(workDir, dockerfile, target, buildArgs)
+}
+
+//CreateContextFromWorkingDir creates a build context of the provided directory and writes it to the Writer.
+//If a target stage is provided, only the files required to build the target are included in the referenced context mode.
+//A Dockerfile outside of the work dir is added as constants.InjectedDockerfile.
+func CreateContextFromWorkingDir(workDir, dockerfile, target, mode string, w io.Writer, buildArgs []string) error {
+	gzw := gzip.NewWriter(w)
+	defer gzw.Close()
+
+	tw := tar.NewWriter(gzw)
+	defer tw.Close()
+
+	return walkContext(workDir, dockerfile, target, mode, buildArgs, func(name, path string, info os.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, info.Name())
+		if err != nil {
+			return errors.Wrap(err, "creating tar file info header")
+		}
+		header.Name = name
+
+		return copyFile(header, path, tw)
+	}, nil)
+}
+
+//GetContextStats returns the number of files and their size sent as build context in the mode, without creating the context
+func GetContextStats(workDir, dockerfile, target, mode string, buildArgs []string) (ContextStats, error) {
+	var stats ContextStats
+	err := walkContext(workDir, dockerfile, target, mode, buildArgs, func(name, path string, info os.FileInfo) error {
+		stats.Files++
+		stats.Size += info.Size()
+		return nil
+	}, nil)
+	return stats, err
+}
+
+//ContextEntry is a file sent as build context or a file or directory excluded by the ignore file
+type ContextEntry struct {
+	//Name is the slash separated path inside the build context, names of excluded directories end with a slash
+	Name     string
+	Size     int64
+	Excluded bool
+	//Pattern is the pattern of the ignore file which excluded the file or directory
+	Pattern string
+}
+
+//ContextListing contains the files of a build context and the files excluded from it
+type ContextListing struct {
+	//IgnoreFile is the path of the ignore file, empty if there's none
+	IgnoreFile string
+	Entries    []ContextEntry
+}
+
+//ListContext returns all files sent as build context in the mode and all files and directories excluded by the ignore file,
+//without creating the context. Excluded directories aren't listed recursively.
+func ListContext(workDir, dockerfile, target, mode string, buildArgs []string) (*ContextListing, error) {
+	listing := &ContextListing{IgnoreFile: IgnoreFile(workDir, dockerfile)}
+	err := walkContext(workDir, dockerfile, target, mode, buildArgs, func(name, path string, info os.FileInfo) error {
+		listing.Entries = append(listing.Entries, ContextEntry{Name: name, Size: info.Size()})
+		return nil
+	}, func(name string, isDir bool, pattern string) {
+		if isDir {
+			name += "/"
+		}
+		listing.Entries = append(listing.Entries, ContextEntry{Name: name, Excluded: true, Pattern: pattern})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+//walkContext calls fn for every regular file of the build context with its slash separated name inside the context.
+//If excluded isn't nil, it's called for every file and skipped directory excluded by the ignore file with the pattern excluding it.
+//Files referenced multiple times are only visited once.
+func walkContext(workDir, dockerfile, target, mode string, buildArgs []string,
+	fn func(name, path string, info os.FileInfo) error, excluded func(name string, isDir bool, pattern string)) error {
 	if _, err := os.Stat(workDir); os.IsNotExist(err) {
 		return errors.Wrap(err, "get context from workDir")
 	}
 
-	paths, err := GetFilePaths(workDir, dockerfile, buildArgs) //paths are relative to the directory this executable runs in
+	paths, err := GetContextPaths(workDir, dockerfile, target, mode, buildArgs) //paths are relative to the directory this executable runs in
 	if err != nil {
 		return err
 	}
 
-	pm, err := excludeMatcher(workDir)
+	pm, err := excludeMatcher(workDir, dockerfile)
 	if err != nil {
 		return errors.Wrap(err, "getting exclude pattern matcher")
 	}
 
-	gzw := gzip.NewWriter(w)
-	defer gzw.Close()
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return err
+	}
 
-	tw := tar.NewWriter(gzw)
-	defer tw.Close()
+	seen := make(map[string]bool)
+	//visit sends or excludes the file or directory at the path, returns filepath.SkipDir for excluded directories
+	visit := func(path string, info os.FileInfo) error {
+		rel, err := relToWorkDir(absWorkDir, path) //patterns are matched against the path relative to the work dir
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if skip, err := shouldSkipPath(pm, info.IsDir(), rel); skip {
+			if excluded != nil && !seen[name] && (!info.IsDir() || err == filepath.SkipDir) {
+				excluded(name, info.IsDir(), matchingPattern(pm, rel))
+			}
+			seen[name] = true
+			return err
+		}
+
+		if !info.Mode().IsRegular() || seen[name] {
+			return nil
+		}
+		seen[name] = true
+
+		return fn(name, path, info)
+	}
 
 	for _, path := range paths {
 		info, err := os.Stat(path)
@@ -59,58 +182,29 @@ func CreateContextFromWorkingDir(workDir, dockerfile string, w io.Writer, buildA
 
 		if info.IsDir() {
 			err := filepath.Walk(path, func(p string, info os.FileInfo, walkErr error) error {
-				if p == path {
-					return nil
+				if walkErr != nil {
+					return walkErr
 				}
-
-				rel, err := filepath.Rel(workDir, p) //make path relative to work dir
-				if err != nil {
-					return err
-				}
-
-				if skip, err := shouldSkipPath(pm, info.IsDir(), rel); skip {
-					return err
-				}
-
-				if !info.Mode().IsRegular() {
+				if p == path {
 					return nil
 				}
-
-				header, err := tar.FileInfoHeader(info, info.Name())
-				if err != nil {
-					return errors.Wrap(err, "creating tar file info header")
-				}
-				header.Name = filepath.ToSlash(rel)
-
-				return copyFile(header, p, tw)
+				return visit(p, info)
 			})
 			if err != nil {
 				return err
 			}
-		} else {
-			if skip, _ := shouldSkipPath(pm, info.IsDir(), path); skip {
-				continue
-			}
-
-			if !info.Mode().IsRegular() {
-				continue
-			}
-
-			rel, err := filepath.Rel(workDir, path) //make path relative to work dir
-			if err != nil {
-				return err
-			}
-
-			header, err := tar.FileInfoHeader(info, info.Name())
-			if err != nil {
-				return errors.Wrap(err, "creating tar file info header")
-			}
-			header.Name = filepath.ToSlash(rel)
+		} else if err := visit(path, info); err != nil {
+			return err
+		}
+	}
 
-			if err := copyFile(header, path, tw); err != nil {
-				return err
-			}
+	if ContextDockerfilePath(workDir, dockerfile) == constants.InjectedDockerfile {
+		path := LocalDockerfilePath(workDir, dockerfile)
+		info, err := os.Stat(path)
+		if err != nil {
+			return errors.Wrap(err, "adding Dockerfile to the context")
 		}
+		return fn(constants.InjectedDockerfile, path, info)
 	}
 
 	return nil
@@ -121,6 +215,7 @@ func copyFile(header *tar.Header, path string, to *tar.Writer) error {
 	if err != nil {
 		return errors.Wrap(err, "opening file")
 	}
+	defer f.Close()
 
 	err = to.WriteHeader(header)
 	if err != nil {
@@ -134,6 +229,15 @@ func copyFile(header *tar.Header, path string, to *tar.Writer) error {
 	return nil
 }
 
+//relToWorkDir returns the path relative to the work dir, paths relative to the cwd are made absolute first
+func relToWorkDir(absWorkDir, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absWorkDir, abs)
+}
+
 func shouldSkipPath(pm *fileutils.PatternMatcher, isDir bool, relPath string) (bool, error) {
 	skip, err := pm.Matches(relPath)
 	if err != nil {
@@ -168,24 +272,67 @@ func shouldSkipPath(pm *fileutils.PatternMatcher, isDir bool, relPath string) (b
 	return false, nil
 }
 
-func excludeMatcher(dir string) (*fileutils.PatternMatcher, error) {
+//IgnoreFile returns the path of the ignore file of the build context. Like BuildKit, a <Dockerfile>.dockerignore next to the
+//Dockerfile takes precedence over the .dockerignore in the work dir. An empty path is returned if there's no ignore file.
+func IgnoreFile(workDir, dockerfile string) string {
+	for _, path := range []string{LocalDockerfilePath(workDir, dockerfile) + ".dockerignore", filepath.Join(workDir, ".dockerignore")} {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+//excludeMatcher returns a matcher for the patterns of the ignore file. The ignore files themselves are excluded,
+//the Dockerfile is always sent since Kaniko reads it from the build context.
+func excludeMatcher(workDir, dockerfile string) (*fileutils.PatternMatcher, error) {
 	var excludes []string
+	dfPath := ContextDockerfilePath(workDir, dockerfile)
 
-	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
-	switch {
-	case os.IsNotExist(err):
-		return fileutils.NewPatternMatcher(excludes)
-	case err != nil:
-		return nil, err
+	if path := IgnoreFile(workDir, dockerfile); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		excludes, err = dockerignore.ReadAll(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", path)
+		}
+
+		excludes = append(excludes, ".dockerignore")
+		if dfPath != constants.InjectedDockerfile {
+			excludes = append(excludes, filepath.FromSlash(dfPath)+".dockerignore")
+		}
 	}
-	defer f.Close()
 
-	excludes, err = dockerignore.ReadAll(f)
-	if err != nil {
-		return nil, err
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil || dfPath == constants.InjectedDockerfile {
+		return pm, err
+	}
+
+	if skip, _ := pm.Matches(filepath.FromSlash(dfPath)); skip {
+		return fileutils.NewPatternMatcher(append(excludes, "!"+filepath.FromSlash(dfPath)))
 	}
+	return pm, nil
+}
 
-	excludes = append(excludes, ".dockerignore")
+//matchingPattern returns the last pattern matching the path, which decides if the path is excluded
+func matchingPattern(pm *fileutils.PatternMatcher, relPath string) string {
+	var last string
+	for _, pattern := range pm.Patterns() {
+		single, err := fileutils.NewPatternMatcher([]string{pattern.String()})
+		if err != nil {
+			continue
+		}
 
-	return fileutils.NewPatternMatcher(excludes)
+		if match, _ := single.Matches(relPath); match {
+			last = pattern.String()
+			if pattern.Exclusion() {
+				last = "!" + last
+			}
+		}
+	}
+	return last
 }
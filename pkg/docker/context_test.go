@@ -0,0 +1,203 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+)
+
+func TestContextDockerfilePath(t *testing.T) {
+	abs, err := filepath.Abs("test/Dockerfile.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		dockerfile string
+		expected   string
+	}{
+		{dockerfile: "Dockerfile.test", expected: "Dockerfile.test"},
+		{dockerfile: "./sub/../Dockerfile.test", expected: "Dockerfile.test"},
+		{dockerfile: abs, expected: "Dockerfile.test"},
+		{dockerfile: "../Dockerfile", expected: constants.InjectedDockerfile},
+		{dockerfile: filepath.Join(os.TempDir(), "Dockerfile"), expected: constants.InjectedDockerfile},
+	}
+
+	for _, test := range tests {
+		if path := ContextDockerfilePath("test", test.dockerfile); path != test.expected {
+			t.Errorf("Expected context path %s of %s but got %s", test.expected, test.dockerfile, path)
+		}
+	}
+}
+
+func TestInjectDockerfile(t *testing.T) {
+	f, err := ioutil.TempFile("", "Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("FROM scratch\nCOPY test.go .\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	paths, err := GetFilePaths("test", f.Name(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"test/test.go"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %s but got %s", expected, paths)
+	}
+
+	var buf bytes.Buffer
+	if err := CreateContextFromWorkingDir("test", f.Name(), "", constants.ContextModeReferenced, &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	gzr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+
+	expected := []string{"test.go", constants.InjectedDockerfile}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected context files %s but got %s", expected, names)
+	}
+}
+
+func TestGetContextStats(t *testing.T) {
+	referenced, err := GetContextStats("test", "Dockerfile.test", "", constants.ContextModeReferenced, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if referenced.Files != 2 {
+		t.Errorf("Expected 2 files in the referenced context but got %d", referenced.Files)
+	}
+
+	full, err := GetContextStats("test", "Dockerfile.test", "", constants.ContextModeFull, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected ContextStats
+	err = filepath.Walk("test", func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			expected.Files++
+			expected.Size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full != expected {
+		t.Errorf("Expected full context %+v but got %+v", expected, full)
+	}
+
+	if _, err := GetContextStats("test", "Dockerfile.test", "", "partial", nil); err == nil {
+		t.Error("Expected an error for an unknown context mode but got none")
+	}
+}
+
+func TestListContext(t *testing.T) {
+	var tests = []struct {
+		dockerfile string
+		ignoreFile string
+		expected   []ContextEntry
+	}{
+		{
+			dockerfile: "Dockerfile",
+			ignoreFile: "test/ignore/.dockerignore",
+			expected: []ContextEntry{
+				{Name: ".dockerignore", Excluded: true, Pattern: ".dockerignore"},
+				{Name: "Dockerfile", Size: 25}, //the Dockerfile is always sent
+				{Name: "app.log", Excluded: true, Pattern: "*.log"},
+				{Name: "build.Dockerfile", Size: 25},
+				{Name: "build.Dockerfile.dockerignore", Size: 4},
+				{Name: "keep.log", Size: 5},
+				{Name: "secrets/", Excluded: true, Pattern: "secrets"},
+				{Name: "src/main.go", Size: 13},
+			},
+		},
+		{
+			dockerfile: "build.Dockerfile",
+			ignoreFile: "test/ignore/build.Dockerfile.dockerignore",
+			expected: []ContextEntry{
+				{Name: ".dockerignore", Excluded: true, Pattern: ".dockerignore"},
+				{Name: "Dockerfile", Size: 25},
+				{Name: "app.log", Size: 6},
+				{Name: "build.Dockerfile", Size: 25},
+				{Name: "build.Dockerfile.dockerignore", Excluded: true, Pattern: "build.Dockerfile.dockerignore"},
+				{Name: "keep.log", Size: 5},
+				{Name: "secrets/key.txt", Size: 4},
+				{Name: "src/", Excluded: true, Pattern: "src"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		listing, err := ListContext("test/ignore", test.dockerfile, "", constants.ContextModeReferenced, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if listing.IgnoreFile != filepath.FromSlash(test.ignoreFile) {
+			t.Errorf("Expected ignore file %s but got %s", test.ignoreFile, listing.IgnoreFile)
+		}
+		if !reflect.DeepEqual(listing.Entries, test.expected) {
+			t.Errorf("Expected entries %+v of %s but got %+v", test.expected, test.dockerfile, listing.Entries)
+		}
+	}
+}
+
+func TestExcludeWithAbsoluteWorkDir(t *testing.T) {
+	workDir, err := filepath.Abs("test/ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetContextStats(workDir, "Dockerfile", "", constants.ContextModeReferenced, nil) //referenced paths are relative to the cwd
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 5 {
+		t.Errorf("Expected 5 files in the context but got %d", stats.Files)
+	}
+}
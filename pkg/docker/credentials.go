@@ -28,19 +28,26 @@ import (
 
 	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/cedrickring/kbuild/pkg/util"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type dockerConfig struct {
-	Auths map[string]auth `json:"auths"`
+	Auths       map[string]auth   `json:"auths"`
+	CredsStore  string            `json:"credsStore,omitempty"`
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
 }
 
 type auth struct {
-	Auth string `json:"auth"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
 }
 
+const dockerHubRegistry = "index.docker.io"
+
 var registryRegex = regexp.MustCompile(`^((.*)\.)?(.*)\.(.*)/`)
 
 //GuessRegistryFromTag guesses the container registry based on the provided image tag.
@@ -53,6 +60,27 @@ func GuessRegistryFromTag(imageTag string) string {
 	return "https://index.docker.io/v1/"
 }
 
+//GetRegistries returns the distinct registries of all provided image references
+func GetRegistries(images []string) []string {
+	var registries []string
+	seen := make(map[string]bool)
+
+	for _, image := range images {
+		ref, err := name.ParseReference(image, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+
+		registry := normalizeRegistry(ref.Context().RegistryStr())
+		if !seen[registry] {
+			seen[registry] = true
+			registries = append(registries, registry)
+		}
+	}
+
+	return registries
+}
+
 //GetCredentialsFromFlags creates a dockerconfig "auths" object containing the provided credentials
 func GetCredentialsFromFlags(username, password, registry string) ([]byte, error) {
 	encoded := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", username, password)))
@@ -66,8 +94,69 @@ func GetCredentialsFromFlags(username, password, registry string) ([]byte, error
 	return json.Marshal(config)
 }
 
-//GetCredentialsFromConfig reads the docker config located at ~/.docker/config.json
-func GetCredentialsFromConfig() ([]byte, error) {
+//GetCredentialsFromConfig reads the docker config located at ~/.docker/config.json and creates a dockerconfig
+//"auths" object containing only the credentials of the provided registries. Credentials stored by credential
+//helpers ("credHelpers" or "credsStore") are resolved by invoking the helper as Kaniko can't access them.
+func GetCredentialsFromConfig(registries []string) ([]byte, error) {
+	cfg, err := readDockerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	auths := make(map[string]auth)
+	var included, missing []string
+
+	for _, registry := range registries {
+		key, a, err := cfg.resolveAuth(registry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting credentials for %s", registry)
+		}
+		if key == "" {
+			missing = append(missing, registry)
+			continue
+		}
+
+		auths[key] = a
+		included = append(included, registry)
+	}
+
+	if len(included) > 0 {
+		logrus.Infof("Including credentials for registries: %s", strings.Join(included, ", "))
+	}
+	if len(missing) > 0 {
+		logrus.Infof("No credentials found for registries: %s", strings.Join(missing, ", "))
+	}
+
+	return json.Marshal(dockerConfig{Auths: auths})
+}
+
+//resolveAuth returns the "auths" key and credentials of the registry, either from the configured
+//credential helper or the "auths" object. Returns an empty key if there are no credentials.
+func (c dockerConfig) resolveAuth(registry string) (string, auth, error) {
+	if helper := c.credentialHelper(registry); helper != "" {
+		serverURL := registryConfigKey(registry)
+		creds, err := getFromCredentialHelper(helper, serverURL)
+		if err != nil {
+			return "", auth{}, err
+		}
+		if creds != nil {
+			return serverURL, creds.toAuth(), nil
+		}
+	}
+
+	for key, a := range c.Auths {
+		if a.Auth == "" && a.IdentityToken == "" { //entries of registries stored by a credential helper are empty
+			continue
+		}
+		if normalizeRegistry(key) == registry {
+			return key, a, nil
+		}
+	}
+
+	return "", auth{}, nil
+}
+
+func readDockerConfig() (*dockerConfig, error) {
 	home := util.HomeDir()
 	if home == "" {
 		return nil, errors.New("Can't find docker config at ~/.docker/config.json")
@@ -78,20 +167,62 @@ func GetCredentialsFromConfig() ([]byte, error) {
 		return nil, errors.New("Can't find docker config at ~/.docker/config.json")
 	}
 
-	return ioutil.ReadFile(dockerConfigPath)
+	data, err := ioutil.ReadFile(dockerConfigPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading docker config")
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing docker config")
+	}
+
+	return &cfg, nil
+}
+
+//credentialHelper returns the name of the credential helper responsible for the registry
+func (c dockerConfig) credentialHelper(registry string) string {
+	for key, helper := range c.CredHelpers {
+		if normalizeRegistry(key) == registry {
+			return helper
+		}
+	}
+	return c.CredsStore
+}
+
+//normalizeRegistry strips the scheme and path of a registry and maps all docker hub aliases to index.docker.io
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	registry = strings.SplitN(registry, "/", 2)[0]
+
+	switch registry {
+	case "docker.io", "registry-1.docker.io", dockerHubRegistry:
+		return dockerHubRegistry
+	}
+	return registry
+}
+
+//registryConfigKey returns the key of the registry used in the "auths" object of the docker config
+func registryConfigKey(registry string) string {
+	if registry == dockerHubRegistry {
+		return "https://index.docker.io/v1/"
+	}
+	return registry
 }
 
-//GetCredentialsAsConfigMap creates a new v1.ConfigMap with the provided credentials
-func GetCredentialsAsConfigMap(credentials []byte) *v1.ConfigMap {
-	return &v1.ConfigMap{
+//GetCredentialsAsSecret creates a new kubernetes.io/dockerconfigjson v1.Secret with the provided credentials.
+//The name of the secret is chosen when the build is started.
+func GetCredentialsAsSecret(credentials []byte) *v1.Secret {
+	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: constants.ConfigMapName,
 			Labels: map[string]string{
-				"builder": "kaniko",
+				constants.BuilderLabel: "kaniko",
 			},
 		},
-		Data: map[string]string{
-			"config.json": string(credentials),
+		Type: v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			v1.DockerConfigJsonKey: credentials,
 		},
 	}
 }
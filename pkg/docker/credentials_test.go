@@ -17,6 +17,11 @@
 package docker
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -46,3 +51,60 @@ func TestGuessRegistryFromTag(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRegistries(t *testing.T) {
+	registries := GetRegistries([]string{"openjdk:latest", "docker.io/library/golang", "gcr.io/project/image:tag", "gcr.io/project/cache"})
+	expected := []string{"index.docker.io", "gcr.io"}
+
+	if !reflect.DeepEqual(registries, expected) {
+		t.Errorf("Expected %s but got %s", expected, registries)
+	}
+}
+
+func TestGetCredentialsFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kbuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, ".docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := `{"auths": {"gcr.io": {}, "https://my.registry.com": {"auth": "dXNlcjpwYXNz"}, "other.registry.com": {"auth": "b3RoZXI6cGFzcw=="}}, "credHelpers": {"gcr.io": "fake"}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, ".docker", "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	helper := "#!/bin/sh\ncat > /dev/null\necho '{\"ServerURL\": \"gcr.io\", \"Username\": \"_token\", \"Secret\": \"secret\"}'\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("HOME", dir)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	credentials, err := GetCredentialsFromConfig([]string{"gcr.io", "my.registry.com", "index.docker.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(credentials, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]auth{
+		"gcr.io":                  {Auth: "X3Rva2VuOnNlY3JldA=="},
+		"https://my.registry.com": {Auth: "dXNlcjpwYXNz"},
+	}
+	if !reflect.DeepEqual(cfg.Auths, expected) {
+		t.Errorf("Expected %v but got %v", expected, cfg.Auths)
+	}
+	if cfg.CredHelpers != nil || cfg.CredsStore != "" {
+		t.Errorf("Expected credential helpers to be removed but got %v", cfg)
+	}
+}
@@ -23,107 +23,144 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
-	"github.com/moby/buildkit/frontend/dockerfile/shell"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 var urlRegex = regexp.MustCompile("^https?://(.*)")
 
-//GetFilePaths returns all paths required to build the docker image
-func GetFilePaths(workDir, dockerfile string, buildArgs []string) ([]string, error) {
-	dfPath := filepath.ToSlash(filepath.Join(workDir, dockerfile))
-	f, err := os.Open(dfPath)
+//GetFilePaths returns all paths required to build the docker image.
+//If a target stage is provided, only the paths of the target and the stages it depends on are returned.
+//A Dockerfile outside of the work dir isn't returned, it's injected into the build context by CreateContextFromWorkingDir.
+func GetFilePaths(workDir, dockerfile, target string, buildArgs []string) ([]string, error) {
+	dfPath := filepath.ToSlash(LocalDockerfilePath(workDir, dockerfile))
+	df, err := ParseDockerfile(dfPath, buildArgs)
 	if err != nil {
-		return nil, errors.Wrap(err, "opening dockerfile")
+		return nil, err
 	}
 
-	result, err := parser.Parse(f)
-	if err != nil {
-		return nil, errors.Wrap(err, "parsing dockerfile")
+	var stages []int
+	if target != "" {
+		stages, err = df.Dependencies(target)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolving target")
+		}
+	} else {
+		for i := range df.Stages {
+			stages = append(stages, i)
+		}
 	}
 
 	var paths []string
+	for _, i := range stages {
+		for _, c := range df.Stages[i].Copies {
+			if c.From != "" {
+				continue //files are copied from another stage or image, not from the build context
+			}
 
-	children := result.AST.Children
-
-	envVars := make(map[string]string)
-	args, err := parseBuildArgs(buildArgs)
-	if err != nil {
-		return nil, errors.Wrap(err, "parsing build args from flags")
-	}
-
-	for _, node := range children {
-		switch node.Value {
-		case command.Copy, command.Add:
-			parsed, err := parseCopyOrAdd(workDir, node, envVars, args)
+			parsed, err := parseCopyOrAdd(workDir, c.Sources)
 			if err != nil {
-				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", node.StartLine))
+				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", c.Line))
 			}
 			paths = append(paths, parsed...)
-		case command.Env:
-			envVars[node.Next.Value] = node.Next.Next.Value
-		case command.Arg:
-			err := parseArgCommand(node, args)
-			if err != nil {
-				return nil, err
-			}
 		}
 	}
 
-	paths = append(paths, dfPath) //add Dockerfile every time
+	if ContextDockerfilePath(workDir, dockerfile) != constants.InjectedDockerfile {
+		paths = append(paths, dfPath) //add Dockerfile every time
+	}
 
 	return paths, nil
 }
 
-func parseCopyOrAdd(wd string, node *parser.Node, envVars map[string]string, buildArgs map[string]string) ([]string, error) {
-	var paths []string
+//GetBaseImages returns all external images referenced by FROM and COPY --from instructions of the Dockerfile.
+//References to build stages and "scratch" are omitted.
+func GetBaseImages(workDir, dockerfile string, buildArgs []string) ([]string, error) {
+	df, err := ParseDockerfile(LocalDockerfilePath(workDir, dockerfile), buildArgs)
+	if err != nil {
+		return nil, err
+	}
+	return df.ExternalImages(), nil
+}
 
-	for _, flag := range node.Flags {
-		if strings.HasPrefix(flag, "--from") { //ignore paths copied from another build step
-			return paths, nil
-		}
+//LocalDockerfilePath returns the path of the Dockerfile on the local disk, relative paths are relative to the work dir
+func LocalDockerfilePath(workDir, dockerfile string) string {
+	if filepath.IsAbs(dockerfile) {
+		return dockerfile
 	}
+	return filepath.Join(workDir, dockerfile)
+}
 
-	cwd, err := os.Getwd()
+//ContextDockerfilePath returns the slash separated path of the Dockerfile inside the build context.
+//A Dockerfile outside of the work dir is injected into the build context as constants.InjectedDockerfile.
+func ContextDockerfilePath(workDir, dockerfile string) string {
+	absWorkDir, err := filepath.Abs(workDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting workdir")
+		return constants.InjectedDockerfile
+	}
+	absDockerfile, err := filepath.Abs(LocalDockerfilePath(workDir, dockerfile))
+	if err != nil {
+		return constants.InjectedDockerfile
 	}
 
-	lex := shell.NewLex(rune('\\'))
-	for node = node.Next; node.Next != nil; node = node.Next {
-		if match := urlRegex.MatchString(node.Value); match {
-			logrus.Infof("Skipping external dependency %s", node.Value)
-			continue //skip external dependencies
-		}
+	rel, err := filepath.Rel(absWorkDir, absDockerfile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return constants.InjectedDockerfile
+	}
+	return filepath.ToSlash(rel)
+}
 
-		if !filepath.IsAbs(wd) {
-			wd, err = filepath.Abs(wd)
-			if err != nil {
-				return nil, err
-			}
-		}
-		abs := filepath.ToSlash(filepath.Join(wd, node.Value)) //need forward-slashes in windows so they don't get escaped by lex
+//readDockerfile returns the parsed instructions of the Dockerfile at the path
+func readDockerfile(path string) ([]*parser.Node, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening dockerfile")
+	}
+	defer f.Close()
 
-		for key, value := range buildArgs {
-			if _, ok := envVars[key]; ok {
-				continue //ENV variables always override ARG variables
-			}
+	result, err := parser.Parse(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing dockerfile")
+	}
+	return result.AST.Children, nil
+}
 
-			r := regexp.MustCompile(`(\$` + key + `|\${` + key + `})`)
-			submatch := r.FindStringSubmatch(abs)
-			if len(submatch) > 0 {
-				abs = r.ReplaceAllString(abs, value)
-			}
-		}
+//fromStageName returns the lowercase name of the stage defined by `FROM <image> AS <name>`
+func fromStageName(node *parser.Node) string {
+	if node.Next == nil || node.Next.Next == nil || node.Next.Next.Next == nil {
+		return ""
+	}
+	if !strings.EqualFold(node.Next.Next.Value, "as") {
+		return ""
+	}
+	return strings.ToLower(node.Next.Next.Next.Value)
+}
+
+//parseCopyOrAdd returns the paths of the expanded sources of a COPY or ADD instruction relative to the current directory
+func parseCopyOrAdd(wd string, sources []string) ([]string, error) {
+	var paths []string
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting workdir")
+	}
 
-		expanded, err := lex.ProcessWordWithMap(abs, envVars)
+	if !filepath.IsAbs(wd) {
+		wd, err = filepath.Abs(wd)
 		if err != nil {
 			return nil, err
 		}
+	}
 
+	for _, source := range sources {
+		if match := urlRegex.MatchString(source); match {
+			logrus.Infof("Skipping external dependency %s", source)
+			continue //skip external dependencies
+		}
+
+		expanded := filepath.Join(wd, filepath.FromSlash(source))
 		matches, err := filepath.Glob(expanded)
 		if err != nil {
 			return nil, err
@@ -133,7 +170,7 @@ func parseCopyOrAdd(wd string, node *parser.Node, envVars map[string]string, bui
 		for _, match := range matches {
 			rel, err := filepath.Rel(wd, match) //make path relative to work dir to check for paths outside the build context
 			if err != nil || strings.HasPrefix(rel, "..") {
-				return nil, errors.Errorf("path %s is not inside the build context", node.Value)
+				return nil, errors.Errorf("path %s is not inside the build context", source)
 			}
 
 			rel, err = filepath.Rel(cwd, match) //make path relative to cwd so "." gets interpreted correctly
@@ -151,27 +188,6 @@ func parseCopyOrAdd(wd string, node *parser.Node, envVars map[string]string, bui
 	return paths, nil
 }
 
-func parseArgCommand(node *parser.Node, args map[string]string) error {
-	arg := node.Next.Value
-	if _, ok := args[arg]; ok {
-		return nil //skip if arg is set by flag, otherwise check for default value
-	}
-
-	if !strings.Contains(arg, "=") {
-		if _, ok := args[arg]; !ok {
-			return errors.Errorf("required arg %s was not set by --arg flag", arg)
-		}
-		return nil
-	}
-
-	key, value, err := parseArg(arg)
-	if err != nil {
-		return errors.Wrap(err, "parsing ARG command")
-	}
-	args[key] = value
-	return nil
-}
-
 func parseBuildArgs(buildArgs []string) (map[string]string, error) {
 	args := make(map[string]string)
 
@@ -186,12 +202,11 @@ func parseBuildArgs(buildArgs []string) (map[string]string, error) {
 	return args, nil
 }
 
+//parseArg splits KEY=VALUE at the first "=", so the value may contain "=" itself
 func parseArg(arg string) (key, value string, err error) {
-	split := strings.Split(arg, "=")
-	if len(split) != 2 {
+	split := strings.SplitN(arg, "=", 2)
+	if len(split) != 2 || split[0] == "" {
 		return "", "", errors.New("invalid arg format, must be ARG=VALUE")
 	}
-	key = split[0]
-	value = split[1]
-	return key, value, nil
+	return split[0], split[1], nil
 }
@@ -9,6 +9,7 @@ import (
 func TestGetFilePaths(t *testing.T) {
 	var tests = []struct {
 		dockerfile    string
+		target        string
 		expectedPaths []string
 		buildArgs     []string
 		shouldErr     bool
@@ -30,17 +31,40 @@ func TestGetFilePaths(t *testing.T) {
 			shouldErr:     false,
 		},
 		{
-			dockerfile: "Dockerfile.arg-test",
-			shouldErr:  true,
+			dockerfile:    "Dockerfile.arg-test",
+			expectedPaths: []string{"test/Dockerfile.arg-test"}, //ARGs without value are empty
 		},
 		{
 			dockerfile:    "Dockerfile.arg-env-test",
 			expectedPaths: []string{"test/test.go", "test/Dockerfile.arg-env-test"},
 		},
+		{
+			dockerfile:    "Dockerfile.env-test",
+			expectedPaths: []string{"test/test.go", "test/other.go", "test/Dockerfile.env-test"},
+		},
+		{
+			dockerfile:    "Dockerfile.target-test",
+			expectedPaths: []string{"test/other.go", "test/no-included.txt", "test/test.go", "test/Dockerfile.target-test"},
+		},
+		{
+			dockerfile:    "Dockerfile.target-test",
+			target:        "release",
+			expectedPaths: []string{"test/other.go", "test/test.go", "test/Dockerfile.target-test"},
+		},
+		{
+			dockerfile:    "Dockerfile.target-test",
+			target:        "unused",
+			expectedPaths: []string{"test/no-included.txt", "test/Dockerfile.target-test"},
+		},
+		{
+			dockerfile: "Dockerfile.target-test",
+			target:     "missing",
+			shouldErr:  true,
+		},
 	}
 
 	for _, test := range tests {
-		paths, err := GetFilePaths("test", test.dockerfile, test.buildArgs)
+		paths, err := GetFilePaths("test", test.dockerfile, test.target, test.buildArgs)
 		if err != nil {
 			if !test.shouldErr {
 				t.Errorf("Couldn't get file paths: %s", err.Error())
@@ -54,6 +78,18 @@ func TestGetFilePaths(t *testing.T) {
 	}
 }
 
+func TestGetBaseImages(t *testing.T) {
+	images, err := GetBaseImages("test", "Dockerfile.from-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"alpine:3.10", "my.registry.com/tools:1.0"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("Expected %s but got %s", strings.Join(expected, ","), strings.Join(images, ","))
+	}
+}
+
 func TestGetBuildArgs(t *testing.T) {
 	var tests = []struct {
 		buildArgs []string
@@ -65,6 +101,15 @@ func TestGetBuildArgs(t *testing.T) {
 			argsMap:   map[string]string{"ARG1": "VALUE", "ARG2": "VALUE2"},
 			shouldErr: false,
 		},
+		{
+			buildArgs: []string{"ARG=VALUE=WITH=EQUALS"},
+			argsMap:   map[string]string{"ARG": "VALUE=WITH=EQUALS"},
+		},
+		{
+			buildArgs: []string{"=VALUE"},
+			argsMap:   make(map[string]string),
+			shouldErr: true,
+		},
 		{
 			buildArgs: []string{"no-key-value"},
 			argsMap:   make(map[string]string),
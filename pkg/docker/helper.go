@@ -0,0 +1,73 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//tokenUsername is the username returned by credential helpers for identity tokens
+const tokenUsername = "<token>"
+
+//helperCredentials is the response of `docker-credential-<helper> get`
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+//getFromCredentialHelper runs `docker-credential-<helper> get` with the server url on stdin.
+//Returns nil if the helper has no credentials for the server.
+func getFromCredentialHelper(helper, serverURL string) (*helperCredentials, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(fmt.Sprintf("docker-credential-%s", helper), "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(strings.ToLower(output), "credentials not found") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "running docker-credential-%s: %s", helper, output)
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, errors.Wrapf(err, "parsing output of docker-credential-%s", helper)
+	}
+
+	return &creds, nil
+}
+
+//toAuth converts the credentials into an entry of the docker config "auths" object
+func (c helperCredentials) toAuth() auth {
+	if c.Username == tokenUsername {
+		return auth{IdentityToken: c.Secret}
+	}
+
+	return auth{Auth: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", c.Username, c.Secret)))}
+}
@@ -0,0 +1,39 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+//IsPinned returns true if the image reference is pinned to a digest or to a tag other than "latest".
+//References without tag or digest implicitly refer to "latest".
+func IsPinned(image string) (bool, error) {
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid image reference %s", image)
+	}
+
+	switch r := ref.(type) {
+	case name.Digest:
+		return true, nil
+	case name.Tag:
+		return r.TagStr() != "latest", nil
+	}
+	return false, nil
+}
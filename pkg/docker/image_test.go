@@ -0,0 +1,50 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import "testing"
+
+func TestIsPinned(t *testing.T) {
+	var tests = []struct {
+		image     string
+		pinned    bool
+		shouldErr bool
+	}{
+		{image: "gcr.io/kaniko-project/executor", pinned: false},
+		{image: "gcr.io/kaniko-project/executor:latest", pinned: false},
+		{image: "gcr.io/kaniko-project/executor:v0.10.0", pinned: true},
+		{image: "alpine@sha256:72c42ed48c3a2db31b7dafe17d275b634664a708d901ec9fd57b1529280f01fb", pinned: true},
+		{image: "my.registry.com:5000/alpine:3.10", pinned: true},
+		{image: "Invalid:Image", shouldErr: true},
+	}
+
+	for _, test := range tests {
+		pinned, err := IsPinned(test.image)
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Expected no error for %s but got %s", test.image, err)
+			}
+			continue
+		}
+		if test.shouldErr {
+			t.Errorf("Expected error for %s but got none", test.image)
+		}
+		if pinned != test.pinned {
+			t.Errorf("Expected pinned to be %t for %s but got %t", test.pinned, test.image, pinned)
+		}
+	}
+}
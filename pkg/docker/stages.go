@@ -0,0 +1,311 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/pkg/errors"
+)
+
+//Dockerfile is the stage graph of a Dockerfile
+type Dockerfile struct {
+	Stages []Stage
+}
+
+//Stage is a build stage of a Dockerfile, it starts with a FROM instruction
+type Stage struct {
+	Index int
+	//Name is the lowercase name of `FROM <image> AS <name>`, empty for unnamed stages
+	Name string
+	//Base is the image or stage name of the FROM instruction with all global ARGs expanded
+	Base string
+	//BaseStage is the index of the stage used as base image or -1 if Base is an external image
+	BaseStage int
+	//Copies are the COPY and ADD instructions of the stage
+	Copies []CopyInstruction
+	//DependsOn are the sorted indices of the stages this stage uses as base image or copies files from
+	DependsOn []int
+	Line      int
+}
+
+//CopyInstruction is a COPY or ADD instruction
+type CopyInstruction struct {
+	Command string
+	//Sources and Dest are expanded with the ARG and ENV variables of the stage
+	Sources []string
+	Dest    string
+	//From is the stage name, stage index or image of COPY --from with all global ARGs expanded
+	From string
+	//FromStage is the index of the stage referenced by From or -1 if the files are copied from the
+	//build context or an external image
+	FromStage int
+	Chown     string
+	Chmod     string
+	Line      int
+}
+
+//ParseDockerfile parses the Dockerfile at the path, resolves the dependencies between its stages and expands
+//all variables of FROM, COPY and ADD instructions. The build args override the defaults of the ARGs.
+func ParseDockerfile(path string, buildArgs []string) (*Dockerfile, error) {
+	nodes, err := readDockerfile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := parseBuildArgs(buildArgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing build args from flags")
+	}
+
+	return newDockerfile(nodes, args)
+}
+
+func newDockerfile(nodes []*parser.Node, buildArgs map[string]string) (*Dockerfile, error) {
+	df := &Dockerfile{}
+	names := make(map[string]int)
+	vars := newScope(buildArgs)
+	var stageEnvs []map[string]string
+
+	for _, node := range nodes {
+		if (node.Value == command.Arg || node.Value == command.From) && node.Next == nil {
+			return nil, errors.Errorf("Dockerfile line %d: %s requires at least one argument", node.StartLine, strings.ToUpper(node.Value))
+		}
+
+		switch {
+		case node.Value == command.Arg:
+			if err := vars.declareArgs(node); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", node.StartLine))
+			}
+		case node.Value == command.From:
+			base, err := vars.expandGlobal(node.Next.Value)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", node.StartLine))
+			}
+
+			stage := Stage{
+				Index:     len(df.Stages),
+				Name:      fromStageName(node),
+				Base:      base,
+				BaseStage: -1,
+				Line:      node.StartLine,
+			}
+
+			var baseEnv map[string]string
+			if i, ok := names[strings.ToLower(base)]; ok { //FROM only accepts stage names, not indices
+				stage.BaseStage = i
+				stage.DependsOn = []int{i}
+				baseEnv = stageEnvs[i]
+			}
+			if stage.Name != "" {
+				if _, ok := names[stage.Name]; ok {
+					return nil, errors.Errorf("Dockerfile line %d: duplicate stage name %s", node.StartLine, stage.Name)
+				}
+				names[stage.Name] = stage.Index
+			}
+
+			vars.enterStage(baseEnv)
+			stageEnvs = append(stageEnvs, vars.env)
+			df.Stages = append(df.Stages, stage)
+		case !vars.inStage():
+			continue //only ARGs are allowed before the first FROM
+		case node.Value == command.Env:
+			if err := vars.setEnv(node); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", node.StartLine))
+			}
+		case node.Value == command.Copy || node.Value == command.Add:
+			stage := &df.Stages[len(df.Stages)-1]
+
+			c, err := parseCopyInstruction(node)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", node.StartLine))
+			}
+			if err := c.expand(vars); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Dockerfile line %d", node.StartLine))
+			}
+			if c.From != "" {
+				c.FromStage = resolveStage(c.From, names, stage.Index)
+				if c.FromStage >= 0 {
+					stage.DependsOn = appendUnique(stage.DependsOn, c.FromStage)
+				}
+			}
+			stage.Copies = append(stage.Copies, c)
+		}
+	}
+
+	return df, nil
+}
+
+//expand replaces the variables of the sources and the destination with the variables of the stage
+//and the variables of --from with the global ARGs. Sources which expand to an empty string are dropped.
+func (c *CopyInstruction) expand(vars *scope) error {
+	sources := c.Sources[:0]
+	for _, source := range c.Sources {
+		expanded, err := vars.expand(source)
+		if err != nil {
+			return err
+		}
+		if expanded != "" {
+			sources = append(sources, expanded)
+		}
+	}
+	c.Sources = sources
+
+	var err error
+	if c.Dest, err = vars.expand(c.Dest); err != nil {
+		return err
+	}
+	if c.From != "" {
+		if c.From, err = vars.expandGlobal(c.From); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//parseCopyInstruction parses the flags and arguments of a COPY or ADD instruction
+func parseCopyInstruction(node *parser.Node) (CopyInstruction, error) {
+	c := CopyInstruction{
+		Command:   node.Value,
+		FromStage: -1,
+		Line:      node.StartLine,
+	}
+
+	for _, flag := range node.Flags {
+		split := strings.SplitN(strings.TrimPrefix(flag, "--"), "=", 2)
+		if len(split) != 2 {
+			continue //flags without value don't change the sources
+		}
+
+		switch split[0] {
+		case "from":
+			if node.Value == command.Add {
+				return c, errors.New("ADD doesn't support --from")
+			}
+			c.From = split[1]
+		case "chown":
+			c.Chown = split[1]
+		case "chmod":
+			c.Chmod = split[1]
+		}
+	}
+
+	var args []string
+	for n := node.Next; n != nil; n = n.Next {
+		args = append(args, n.Value)
+	}
+	if len(args) < 2 {
+		return c, errors.Errorf("%s requires at least two arguments", strings.ToUpper(node.Value))
+	}
+	c.Sources = args[:len(args)-1]
+	c.Dest = args[len(args)-1]
+
+	return c, nil
+}
+
+//resolveStage returns the index of a previous stage referenced by name or index or -1 if ref is an image
+func resolveStage(ref string, names map[string]int, current int) int {
+	if i, ok := names[strings.ToLower(ref)]; ok && i < current {
+		return i
+	}
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < current {
+		return i
+	}
+	return -1
+}
+
+func appendUnique(indices []int, index int) []int {
+	for _, i := range indices {
+		if i == index {
+			return indices
+		}
+	}
+	indices = append(indices, index)
+	sort.Ints(indices)
+	return indices
+}
+
+//Stage returns the stage with the name or index
+func (d Dockerfile) Stage(ref string) (*Stage, error) {
+	for i := range d.Stages {
+		if d.Stages[i].Name != "" && d.Stages[i].Name == strings.ToLower(ref) {
+			return &d.Stages[i], nil
+		}
+	}
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(d.Stages) {
+		return &d.Stages[i], nil
+	}
+	return nil, errors.Errorf("stage %s not found in Dockerfile", ref)
+}
+
+//Dependencies returns the sorted indices of the target stage and all stages it depends on directly or transitively
+func (d Dockerfile) Dependencies(target string) ([]int, error) {
+	stage, err := d.Stage(target)
+	if err != nil {
+		return nil, err
+	}
+
+	required := make(map[int]bool)
+	var visit func(i int)
+	visit = func(i int) {
+		if required[i] {
+			return
+		}
+		required[i] = true
+		for _, dep := range d.Stages[i].DependsOn {
+			visit(dep)
+		}
+	}
+	visit(stage.Index)
+
+	indices := make([]int, 0, len(required))
+	for i := range required {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
+
+//ExternalImages returns all images referenced by FROM and COPY --from which aren't build stages.
+//"scratch" is omitted.
+func (d Dockerfile) ExternalImages() []string {
+	var images []string
+	seen := map[string]bool{"scratch": true}
+	add := func(image string) {
+		if !seen[strings.ToLower(image)] {
+			seen[strings.ToLower(image)] = true
+			images = append(images, image)
+		}
+	}
+
+	for _, stage := range d.Stages {
+		if stage.BaseStage < 0 {
+			add(stage.Base)
+		}
+		for _, c := range stage.Copies {
+			if c.From != "" && c.FromStage < 0 {
+				add(c.From)
+			}
+		}
+	}
+	return images
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	df, err := ParseDockerfile("test/Dockerfile.stages-test", []string{"GO_VERSION=1.13"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Stage{
+		{
+			Index:     0,
+			Name:      "builder",
+			Base:      "golang:1.13",
+			BaseStage: -1,
+			Copies: []CopyInstruction{
+				{Command: "copy", Sources: []string{"test.go"}, Dest: "/src/", FromStage: -1, Chown: "1000:1000", Line: 3},
+			},
+			Line: 2,
+		},
+		{
+			Index:     1,
+			Name:      "test",
+			Base:      "builder",
+			BaseStage: 0,
+			Copies: []CopyInstruction{
+				{Command: "copy", Sources: []string{"/src/test.go"}, Dest: "/test/", From: "0", FromStage: 0, Line: 6},
+			},
+			DependsOn: []int{0},
+			Line:      5,
+		},
+		{
+			Index:     2,
+			Base:      "alpine:3.10",
+			BaseStage: -1,
+			Copies: []CopyInstruction{
+				{Command: "copy", Sources: []string{"/bin/tool"}, Dest: "/bin/", From: "my.registry.com/tools:1.0", FromStage: -1, Line: 9},
+				{Command: "copy", Sources: []string{"/test/test.go"}, Dest: "/app/", From: "test", FromStage: 1, Chmod: "755", Line: 10},
+			},
+			DependsOn: []int{1},
+			Line:      8,
+		},
+	}
+	if !reflect.DeepEqual(df.Stages, expected) {
+		t.Errorf("Expected stages %+v but got %+v", expected, df.Stages)
+	}
+
+	images := df.ExternalImages()
+	expectedImages := []string{"golang:1.13", "alpine:3.10", "my.registry.com/tools:1.0"}
+	if !reflect.DeepEqual(images, expectedImages) {
+		t.Errorf("Expected images %s but got %s", expectedImages, images)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	df, err := ParseDockerfile("test/Dockerfile.stages-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		target    string
+		expected  []int
+		shouldErr bool
+	}{
+		{target: "builder", expected: []int{0}},
+		{target: "Test", expected: []int{0, 1}},
+		{target: "2", expected: []int{0, 1, 2}},
+		{target: "release", shouldErr: true},
+	}
+
+	for _, test := range tests {
+		deps, err := df.Dependencies(test.target)
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Expected no error for target %s but got %s", test.target, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(deps, test.expected) {
+			t.Errorf("Expected dependencies %v of target %s but got %v", test.expected, test.target, deps)
+		}
+	}
+}
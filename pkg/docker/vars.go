@@ -0,0 +1,150 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/pkg/errors"
+)
+
+//predefinedArgs can be passed as build args and are available in every stage without an ARG instruction
+var predefinedArgs = []string{
+	"HTTP_PROXY", "http_proxy",
+	"HTTPS_PROXY", "https_proxy",
+	"FTP_PROXY", "ftp_proxy",
+	"NO_PROXY", "no_proxy",
+	"ALL_PROXY", "all_proxy",
+}
+
+//scope contains the variables visible at an instruction of a Dockerfile, following the semantics of BuildKit:
+//  - ARGs before the first FROM (global ARGs) are only visible in FROM and COPY --from
+//  - a stage only sees the ARGs it declares itself, an ARG without default inherits the value of the global ARG
+//  - an ARG without any value is empty, like an unset variable
+//  - build args override the defaults of ARGs, but are only visible if an ARG declares them (except predefinedArgs)
+//  - ENV variables take precedence over ARGs and are inherited by stages using the stage as base image
+type scope struct {
+	buildArgs map[string]string
+	global    map[string]string
+	args      map[string]string
+	env       map[string]string
+	lex       *shell.Lex
+}
+
+func newScope(buildArgs map[string]string) *scope {
+	return &scope{
+		buildArgs: buildArgs,
+		global:    make(map[string]string),
+		lex:       shell.NewLex(rune('\\')),
+	}
+}
+
+//enterStage resets the ARGs and ENV variables for a new stage, the ENV of the base stage is inherited
+func (s *scope) enterStage(baseEnv map[string]string) {
+	s.args = make(map[string]string)
+	s.env = make(map[string]string, len(baseEnv))
+	for key, value := range baseEnv {
+		s.env[key] = value
+	}
+}
+
+//inStage returns true once the first FROM instruction was processed
+func (s *scope) inStage() bool {
+	return s.args != nil
+}
+
+//declareArgs processes an ARG instruction, ARGs without build arg, default or global value stay unset
+func (s *scope) declareArgs(node *parser.Node) error {
+	for n := node.Next; n != nil; n = n.Next {
+		key, def, hasDefault := n.Value, "", false
+		if i := strings.Index(n.Value, "="); i >= 0 {
+			key, def, hasDefault = n.Value[:i], n.Value[i+1:], true
+		}
+		if key == "" {
+			return errors.Errorf("invalid ARG %s", n.Value)
+		}
+
+		value, ok := s.buildArgs[key]
+		switch {
+		case ok:
+		case hasDefault:
+			var err error
+			value, err = s.expand(def)
+			if err != nil {
+				return errors.Wrapf(err, "expanding default of ARG %s", key)
+			}
+			ok = true
+		case s.inStage():
+			value, ok = s.global[key]
+		}
+
+		if !ok {
+			continue
+		}
+		if s.inStage() {
+			s.args[key] = value
+		} else {
+			s.global[key] = value
+		}
+	}
+	return nil
+}
+
+//setEnv processes an ENV instruction, which contains one or more key value pairs
+func (s *scope) setEnv(node *parser.Node) error {
+	for n := node.Next; n != nil && n.Next != nil; n = n.Next.Next {
+		value, err := s.expand(n.Next.Value)
+		if err != nil {
+			return errors.Wrapf(err, "expanding ENV %s", n.Value)
+		}
+		s.env[n.Value] = value
+	}
+	return nil
+}
+
+//vars returns all variables visible at the current instruction
+func (s *scope) vars() map[string]string {
+	if !s.inStage() {
+		return s.global
+	}
+
+	vars := make(map[string]string, len(s.args)+len(s.env))
+	for _, key := range predefinedArgs {
+		if value, ok := s.buildArgs[key]; ok {
+			vars[key] = value
+		}
+	}
+	for key, value := range s.args {
+		vars[key] = value
+	}
+	for key, value := range s.env {
+		vars[key] = value
+	}
+	return vars
+}
+
+//expand replaces all variables of the word with their values, e.g. $VAR, ${VAR} or ${VAR:-default}
+func (s *scope) expand(word string) (string, error) {
+	return s.lex.ProcessWordWithMap(word, s.vars())
+}
+
+//expandGlobal replaces all variables of the word with the values of the global ARGs
+func (s *scope) expandGlobal(word string) (string, error) {
+	return s.lex.ProcessWordWithMap(word, s.global)
+}
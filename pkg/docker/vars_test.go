@@ -0,0 +1,70 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariableScoping(t *testing.T) {
+	var tests = []struct {
+		buildArgs []string
+		expected  [][]string //sources and destination of each COPY instruction
+	}{
+		{
+			buildArgs: []string{"NAME=a=b", "HTTP_PROXY=proxy"},
+			expected: [][]string{
+				{"test.go", "/app/"},
+				{"global.go", "/app/"},
+				{"test.go", "unset", "/app/"},
+				{"a=b", "/"},
+				{"env.go", "/proxy/"},
+			},
+		},
+		{
+			expected: [][]string{
+				{"test.go", "/app/"},
+				{"global.go", "/app/"},
+				{"test.go", "unset", "/app/"},
+				{"other.go", "/"},
+				{"env.go", "//"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		df, err := ParseDockerfile("test/Dockerfile.vars-test", test.buildArgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if df.Stages[0].Base != "alpine:3.10" {
+			t.Errorf("Expected base image alpine:3.10 but got %s", df.Stages[0].Base)
+		}
+
+		var copies [][]string
+		for _, stage := range df.Stages {
+			for _, c := range stage.Copies {
+				copies = append(copies, append(append([]string{}, c.Sources...), c.Dest))
+			}
+		}
+		if !reflect.DeepEqual(copies, test.expected) {
+			t.Errorf("Expected copies %v with build args %v but got %v", test.expected, test.buildArgs, copies)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+//Kinds of resources created by kbuild
+const (
+	KindPod       = "Pod"
+	KindSecret    = "Secret"
+	KindConfigMap = "ConfigMap"
+	KindGCSObject = "GCSObject"
+)
+
+//Resource is an object created by a build which may have been left behind
+type Resource struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Bucket    string
+	BuildID   string
+	BuildName string
+	CreatedBy string
+	Created   time.Time
+}
+
+func (r Resource) String() string {
+	if r.Kind == KindGCSObject {
+		return fmt.Sprintf("gs://%s/%s", r.Bucket, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", strings.ToLower(r.Kind), r.Namespace, r.Name)
+}
+
+//Options selects the resources to collect
+type Options struct {
+	Namespace string
+	//Bucket is searched for uploaded build contexts, no bucket is searched if empty
+	Bucket string
+	//OlderThan is the min age of a resource to be collected
+	OlderThan time.Duration
+}
+
+//Find returns all resources created by kbuild which are older than the provided age, sorted by creation time
+func Find(ctx context.Context, opts Options) ([]Resource, error) {
+	client, err := kubernetes.GetClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting kubernetes client")
+	}
+
+	resources, activeBuilds, err := findClusterResources(client, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Bucket != "" {
+		objects, err := findContextObjects(ctx, opts.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, inactive(objects, activeBuilds)...)
+	}
+
+	resources = olderThan(resources, time.Now().Add(-opts.OlderThan))
+	sort.SliceStable(resources, func(i, j int) bool {
+		return resources[i].Created.Before(resources[j].Created)
+	})
+	return resources, nil
+}
+
+//Delete deletes all provided resources. Resources which don't exist anymore are ignored.
+func Delete(ctx context.Context, resources []Resource) error {
+	client, err := kubernetes.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting kubernetes client")
+	}
+
+	var storageClient *storage.Client
+	for _, r := range resources {
+		var err error
+		switch r.Kind {
+		case KindPod:
+			err = client.CoreV1().Pods(r.Namespace).Delete(r.Name, &metav1.DeleteOptions{GracePeriodSeconds: new(int64)})
+		case KindSecret:
+			err = client.CoreV1().Secrets(r.Namespace).Delete(r.Name, &metav1.DeleteOptions{})
+		case KindConfigMap:
+			err = client.CoreV1().ConfigMaps(r.Namespace).Delete(r.Name, &metav1.DeleteOptions{})
+		case KindGCSObject:
+			if storageClient == nil {
+				storageClient, err = storage.NewClient(ctx)
+				if err != nil {
+					return errors.Wrap(err, "creating storage client")
+				}
+				defer storageClient.Close()
+			}
+			err = storageClient.Bucket(r.Bucket).Object(r.Name).Delete(ctx)
+			if err == storage.ErrObjectNotExist {
+				err = nil
+			}
+		default:
+			err = errors.Errorf("unknown kind %s", r.Kind)
+		}
+
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "deleting %s", r)
+		}
+	}
+
+	return nil
+}
+
+//findClusterResources returns all pods, secrets and config maps labeled as kbuild objects and the ids of the active builds.
+//Pods which haven't terminated yet belong to running builds, so they and all other objects of their build are skipped.
+func findClusterResources(client k8s.Interface, namespace string) ([]Resource, map[string]bool, error) {
+	opts := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=kaniko", constants.BuilderLabel),
+	}
+	var resources []Resource
+	activeBuilds := make(map[string]bool)
+
+	pods, err := client.CoreV1().Pods(namespace).List(opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "listing pods")
+	}
+	for _, pod := range pods.Items {
+		if !terminated(pod) {
+			if id := pod.Labels[constants.BuildIDLabel]; id != "" {
+				activeBuilds[id] = true
+			}
+			continue
+		}
+		resources = append(resources, newResource(KindPod, pod.ObjectMeta))
+	}
+
+	secrets, err := client.CoreV1().Secrets(namespace).List(opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "listing secrets")
+	}
+	for _, secret := range secrets.Items {
+		resources = append(resources, newResource(KindSecret, secret.ObjectMeta))
+	}
+
+	configMaps, err := client.CoreV1().ConfigMaps(namespace).List(opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "listing config maps")
+	}
+	for _, configMap := range configMaps.Items {
+		resources = append(resources, newResource(KindConfigMap, configMap.ObjectMeta))
+	}
+
+	return inactive(resources, activeBuilds), activeBuilds, nil
+}
+
+//inactive returns all resources which don't belong to one of the active builds
+func inactive(resources []Resource, activeBuilds map[string]bool) []Resource {
+	var filtered []Resource
+	for _, r := range resources {
+		if r.BuildID == "" || !activeBuilds[r.BuildID] {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+//terminated returns true if the pod is in a terminal phase
+func terminated(pod v1.Pod) bool {
+	switch pod.Status.Phase {
+	case v1.PodPending, v1.PodRunning:
+		return false
+	}
+	return true
+}
+
+//findContextObjects returns all build contexts uploaded to the bucket
+func findContextObjects(ctx context.Context, bucket string) ([]Resource, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating storage client")
+	}
+	defer client.Close()
+
+	it := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: constants.ContextObjectPrefix})
+	resources, err := contextObjects(bucket, it.Next)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing objects of bucket %s", bucket)
+	}
+	return resources, nil
+}
+
+//contextObjects returns the build contexts of the listed objects until next returns iterator.Done.
+//Only objects uploaded by kbuild are returned, which carry the build id as metadata.
+func contextObjects(bucket string, next func() (*storage.ObjectAttrs, error)) ([]Resource, error) {
+	var resources []Resource
+	for {
+		attrs, err := next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(attrs.Name, constants.ContextObjectPrefix) || !strings.HasSuffix(attrs.Name, ".tar.gz") {
+			continue
+		}
+		buildID := attrs.Metadata[constants.BuildIDMetadataKey]
+		if buildID == "" {
+			continue
+		}
+
+		resources = append(resources, Resource{
+			Kind:    KindGCSObject,
+			Name:    attrs.Name,
+			Bucket:  bucket,
+			BuildID: buildID,
+			Created: attrs.Created,
+		})
+	}
+
+	return resources, nil
+}
+
+func newResource(kind string, meta metav1.ObjectMeta) Resource {
+	return Resource{
+		Kind:      kind,
+		Name:      meta.Name,
+		Namespace: meta.Namespace,
+		BuildID:   meta.Labels[constants.BuildIDLabel],
+		BuildName: meta.Annotations[constants.BuildNameAnnotation],
+		CreatedBy: meta.Annotations[constants.CreatedByAnnotation],
+		Created:   meta.CreationTimestamp.Time,
+	}
+}
+
+//olderThan returns all resources created before the cutoff
+func olderThan(resources []Resource, cutoff time.Time) []Resource {
+	var old []Resource
+	for _, r := range resources {
+		if r.Created.Before(cutoff) {
+			old = append(old, r)
+		}
+	}
+	return old
+}
@@ -0,0 +1,183 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gc
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"google.golang.org/api/iterator"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOlderThan(t *testing.T) {
+	now := time.Now()
+	resources := []Resource{
+		{Kind: KindPod, Name: "kaniko-old", Created: now.Add(-2 * time.Hour)},
+		{Kind: KindSecret, Name: "kaniko-credentials-new", Created: now.Add(-time.Minute)},
+		{Kind: KindGCSObject, Name: "context-old.tar.gz", Created: now.Add(-3 * time.Hour)},
+	}
+
+	old := olderThan(resources, now.Add(-time.Hour))
+	if len(old) != 2 {
+		t.Fatalf("Expected 2 resources but got %d", len(old))
+	}
+	if old[0].Name != "kaniko-old" || old[1].Name != "context-old.tar.gz" {
+		t.Errorf("Expected old resources but got %v", old)
+	}
+}
+
+func TestResourceString(t *testing.T) {
+	tests := []struct {
+		resource Resource
+		expected string
+	}{
+		{
+			resource: Resource{Kind: KindPod, Name: "kaniko-abc", Namespace: "builds"},
+			expected: "pod builds/kaniko-abc",
+		},
+		{
+			resource: Resource{Kind: KindGCSObject, Name: "context-abc.tar.gz", Bucket: "mybucket"},
+			expected: "gs://mybucket/context-abc.tar.gz",
+		},
+	}
+
+	for _, test := range tests {
+		if actual := test.resource.String(); actual != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, actual)
+		}
+	}
+}
+
+func testMeta(name, buildID string) metav1.ObjectMeta {
+	labels := map[string]string{constants.BuilderLabel: "kaniko"}
+	if buildID != "" {
+		labels[constants.BuildIDLabel] = buildID
+	}
+	return metav1.ObjectMeta{Name: name, Namespace: "builds", Labels: labels}
+}
+
+func testPod(name, buildID string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{ObjectMeta: testMeta(name, buildID), Status: v1.PodStatus{Phase: phase}}
+}
+
+func TestFindClusterResources(t *testing.T) {
+	unlabeled := testPod("other", "", v1.PodSucceeded)
+	unlabeled.Labels = nil
+
+	client := fake.NewSimpleClientset(
+		testPod("kaniko-done", "done", v1.PodSucceeded),
+		testPod("kaniko-failed", "failed", v1.PodFailed),
+		testPod("kaniko-running", "running", v1.PodRunning),
+		testPod("kaniko-pending", "pending", v1.PodPending),
+		unlabeled,
+		&v1.Secret{ObjectMeta: testMeta("kaniko-credentials-done", "done")},
+		&v1.Secret{ObjectMeta: testMeta("kaniko-credentials-running", "running")},
+		&v1.Secret{ObjectMeta: testMeta("kaniko-credentials-pending", "pending")},
+		&v1.Secret{ObjectMeta: testMeta("kaniko-credentials-orphan", "orphan")},
+		&v1.ConfigMap{ObjectMeta: testMeta("kaniko-context-running", "running")},
+		&v1.ConfigMap{ObjectMeta: testMeta("kaniko-context-failed", "failed")},
+	)
+
+	resources, activeBuilds, err := findClusterResources(client, "builds")
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expectedActive := map[string]bool{"running": true, "pending": true}
+	if !reflect.DeepEqual(activeBuilds, expectedActive) {
+		t.Errorf("Expected active builds %v but got %v", expectedActive, activeBuilds)
+	}
+
+	var actual []string
+	for _, r := range resources {
+		actual = append(actual, r.String())
+	}
+	sort.Strings(actual)
+
+	expected := []string{
+		"configmap builds/kaniko-context-failed",
+		"pod builds/kaniko-done",
+		"pod builds/kaniko-failed",
+		"secret builds/kaniko-credentials-done",
+		"secret builds/kaniko-credentials-orphan",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected resources %v but got %v", expected, actual)
+	}
+}
+
+//listing returns an object iterator over the attrs, like storage.ObjectIterator.Next
+func listing(attrs ...*storage.ObjectAttrs) func() (*storage.ObjectAttrs, error) {
+	return func() (*storage.ObjectAttrs, error) {
+		if len(attrs) == 0 {
+			return nil, iterator.Done
+		}
+		next := attrs[0]
+		attrs = attrs[1:]
+		return next, nil
+	}
+}
+
+func TestContextObjects(t *testing.T) {
+	created := time.Now()
+	metadata := map[string]string{constants.BuildIDMetadataKey: "abc"}
+
+	resources, err := contextObjects("mybucket", listing(
+		&storage.ObjectAttrs{Name: "context-abc.tar.gz", Metadata: metadata, Created: created},
+		&storage.ObjectAttrs{Name: "context-foreign.tar.gz", Created: created},
+		&storage.ObjectAttrs{Name: "context-other.tar.gz", Metadata: map[string]string{"owner": "someone"}, Created: created},
+		&storage.ObjectAttrs{Name: "context-abc.txt", Metadata: metadata, Created: created},
+	))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := []Resource{{Kind: KindGCSObject, Name: "context-abc.tar.gz", Bucket: "mybucket", BuildID: "abc", Created: created}}
+	if !reflect.DeepEqual(resources, expected) {
+		t.Errorf("Expected resources %v but got %v", expected, resources)
+	}
+}
+
+func TestInactiveContextObjects(t *testing.T) {
+	objects := []Resource{
+		{Kind: KindGCSObject, Name: "context-running.tar.gz", BuildID: "running"},
+		{Kind: KindGCSObject, Name: "context-done.tar.gz", BuildID: "done"},
+	}
+
+	actual := inactive(objects, map[string]bool{"running": true})
+	expected := []Resource{{Kind: KindGCSObject, Name: "context-done.tar.gz", BuildID: "done"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected resources %v but got %v", expected, actual)
+	}
+}
+
+func TestContextObjectsError(t *testing.T) {
+	_, err := contextObjects("mybucket", func() (*storage.ObjectAttrs, error) {
+		return nil, errors.New("forbidden")
+	})
+	if err == nil || err.Error() != "forbidden" {
+		t.Errorf("Expected error forbidden but got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package graph
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Node is a single unit of work which may depend on other nodes of the graph
+type Node struct {
+	Name      string
+	DependsOn []string
+	Run       func(ctx context.Context) error
+}
+
+//Status is the final state of a node after executing the graph
+type Status string
+
+//All possible node states
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+	StatusCancelled Status = "cancelled"
+)
+
+//Result contains the outcome of a single node
+type Result struct {
+	Name     string
+	Status   Status
+	Err      error
+	Duration time.Duration
+}
+
+//Options configures the execution of a graph
+type Options struct {
+	//Parallelism is the max number of nodes running at the same time, values < 1 are treated as 1
+	Parallelism int
+	//ContinueOnFailure runs dependents of failed nodes instead of skipping them
+	ContinueOnFailure bool
+}
+
+//ErrorDependencyFailed is the error of a node which was skipped because a dependency didn't succeed
+var ErrorDependencyFailed = errors.New("dependency failed")
+
+//Validate checks the graph for dependency cycles. Dependencies on nodes which are not part of the graph are ignored.
+func Validate(nodes []Node) error {
+	return checkCycles(nodes)
+}
+
+//Execute runs all nodes of the graph, starting a node as soon as all of its dependencies are done.
+//The results are returned in the same order as the provided nodes.
+func Execute(ctx context.Context, nodes []Node, opts Options) ([]Result, error) {
+	if err := checkCycles(nodes); err != nil {
+		return nil, err
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		index[node.Name] = i
+	}
+
+	remaining := make([]int, len(nodes))
+	dependents := make([][]int, len(nodes))
+	for i, node := range nodes {
+		for _, dep := range node.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				continue
+			}
+			remaining[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	results := make([]Result, len(nodes))
+	done := make([]bool, len(nodes))
+	failedDeps := make([]bool, len(nodes))
+
+	var ready []int
+	for i := range nodes {
+		results[i].Name = nodes[i].Name
+		if remaining[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	type finished struct {
+		index    int
+		err      error
+		duration time.Duration
+	}
+	finishedChan := make(chan finished)
+
+	var complete func(i int)
+	complete = func(i int) {
+		done[i] = true
+		failed := results[i].Status != StatusSucceeded
+
+		for _, d := range dependents[i] {
+			if done[d] {
+				continue
+			}
+			if failed {
+				failedDeps[d] = true
+			}
+
+			remaining[d]--
+			if failedDeps[d] && !opts.ContinueOnFailure {
+				results[d].Status = StatusSkipped
+				results[d].Err = ErrorDependencyFailed
+				complete(d)
+				continue
+			}
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	running := 0
+	for {
+		for len(ready) > 0 && running < parallelism && ctx.Err() == nil {
+			i := ready[0]
+			ready = ready[1:]
+			if done[i] {
+				continue
+			}
+
+			running++
+			go func(i int) {
+				start := time.Now()
+				err := nodes[i].Run(ctx)
+				finishedChan <- finished{index: i, err: err, duration: time.Since(start)}
+			}(i)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		f := <-finishedChan
+		running--
+
+		results[f.index].Duration = f.duration
+		results[f.index].Err = f.err
+		switch {
+		case f.err == nil:
+			results[f.index].Status = StatusSucceeded
+		case ctx.Err() != nil:
+			results[f.index].Status = StatusCancelled
+		default:
+			results[f.index].Status = StatusFailed
+		}
+		complete(f.index)
+	}
+
+	for i := range nodes {
+		if results[i].Status == "" {
+			results[i].Status = StatusCancelled
+			results[i].Err = ctx.Err()
+		}
+	}
+
+	return results, nil
+}
+
+//checkCycles returns an error if a node is defined twice or the graph contains a cycle
+func checkCycles(nodes []Node) error {
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		if _, ok := index[node.Name]; ok {
+			return errors.Errorf("duplicate node %q", node.Name)
+		}
+		index[node.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(nodes))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for j, name := range path {
+				if name == nodes[i].Name {
+					start = j
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), nodes[i].Name)
+			return errors.Errorf("dependency cycle %s", strings.Join(cycle, " -> "))
+		}
+
+		state[i] = visiting
+		path = append(path, nodes[i].Name)
+		for _, dep := range nodes[i].DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				continue
+			}
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range nodes {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		nodes     []Node
+		shouldErr bool
+	}{
+		{
+			nodes: []Node{{Name: "a"}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"a", "b"}}},
+		},
+		{
+			nodes: []Node{{Name: "a", DependsOn: []string{"not-selected"}}},
+		},
+		{
+			nodes:     []Node{{Name: "a", DependsOn: []string{"c"}}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"b"}}},
+			shouldErr: true,
+		},
+		{
+			nodes:     []Node{{Name: "a"}, {Name: "a"}},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := Validate(test.nodes)
+		if test.shouldErr && err == nil {
+			t.Errorf("Expected error for nodes %v but got none", test.nodes)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Expected no error but got %s", err)
+		}
+	}
+}
+
+func TestExecuteOrder(t *testing.T) {
+	var mutex sync.Mutex
+	var executed []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			executed = append(executed, name)
+			return nil
+		}
+	}
+
+	nodes := []Node{
+		{Name: "c", DependsOn: []string{"b"}, Run: record("c")},
+		{Name: "b", DependsOn: []string{"a"}, Run: record("b")},
+		{Name: "a", Run: record("a")},
+	}
+
+	results, err := Execute(context.Background(), nodes, Options{Parallelism: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(executed) != 3 || executed[0] != "a" || executed[1] != "b" || executed[2] != "c" {
+		t.Errorf("Expected execution order a, b, c but got %v", executed)
+	}
+
+	for _, result := range results {
+		if result.Status != StatusSucceeded {
+			t.Errorf("Expected %s to succeed but got %s", result.Name, result.Status)
+		}
+	}
+}
+
+func TestExecuteParallelism(t *testing.T) {
+	var running, maxRunning int32
+	run := func(context.Context) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	var nodes []Node
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		nodes = append(nodes, Node{Name: name, Run: run})
+	}
+
+	if _, err := Execute(context.Background(), nodes, Options{Parallelism: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 nodes to run in parallel but got %d", maxRunning)
+	}
+}
+
+func TestExecuteFailure(t *testing.T) {
+	fail := func(context.Context) error { return errors.New("failed") }
+	succeed := func(context.Context) error { return nil }
+
+	tests := []struct {
+		continueOnFailure bool
+		expected          []Status
+	}{
+		{
+			continueOnFailure: false,
+			expected:          []Status{StatusFailed, StatusSkipped, StatusSkipped, StatusSucceeded},
+		},
+		{
+			continueOnFailure: true,
+			expected:          []Status{StatusFailed, StatusSucceeded, StatusSucceeded, StatusSucceeded},
+		},
+	}
+
+	for _, test := range tests {
+		nodes := []Node{
+			{Name: "a", Run: fail},
+			{Name: "b", DependsOn: []string{"a"}, Run: succeed},
+			{Name: "c", DependsOn: []string{"b"}, Run: succeed},
+			{Name: "d", Run: succeed},
+		}
+
+		results, err := Execute(context.Background(), nodes, Options{ContinueOnFailure: test.continueOnFailure})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, result := range results {
+			if result.Status != test.expected[i] {
+				t.Errorf("Expected %s to be %s but got %s", result.Name, test.expected[i], result.Status)
+			}
+		}
+	}
+}
@@ -19,163 +19,304 @@ package kaniko
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/cedrickring/kbuild/pkg/docker"
 	"github.com/cedrickring/kbuild/pkg/kaniko/source"
 	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/cedrickring/kbuild/pkg/patch"
 	"github.com/cedrickring/kbuild/pkg/util"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8s "k8s.io/client-go/kubernetes"
 )
 
 //Build contains all required information to start a Kaniko build
 type Build struct {
-	ImageTags      []string
-	WorkDir        string
-	DockerfilePath string
-	Cache          bool
-	CacheRepo      string
-	Namespace      string
-	BuildArgs      []string
-	CredentialsMap *v1.ConfigMap
-	Source         source.Source
-
-	tarPath string
-}
+	Name              string
+	ImageTags         []string
+	WorkDir           string
+	DockerfilePath    string
+	ContextMode       string
+	Cache             bool
+	CacheRepo         string
+	Namespace         string
+	BuildArgs         []string
+	RedactedBuildArgs []string
+	CredentialsSecret *v1.Secret
+	RegistrySecret    string
+	Source            source.Source
+	Out               io.Writer
+	Timeouts          Timeouts
+	Pod               PodOptions
+	PodOverlay        *patch.Patch
+	Executor          ExecutorOptions
 
-//ErrorBuildFailed is an error for a failed build
-var ErrorBuildFailed = errors.New("build failed")
+	tarPath               string
+	buildID               string
+	credentialsSecretName string
+	podDeadline           time.Duration
+}
 
-//StartBuild starts a Kaniko build with options provided in `Build`
-func (b Build) StartBuild(ctx context.Context) error {
+//StartBuild starts a Kaniko build with options provided in `Build`.
+//A result is returned whenever the build container terminated, even if the build failed.
+//All resources created in the cluster are deleted before returning, even if the build was cancelled.
+func (b Build) StartBuild(ctx context.Context) (*Result, error) {
 	client, err := kubernetes.GetClient()
 	if err != nil {
-		return errors.Wrap(err, "get kubernetes client")
+		return nil, errors.Wrap(err, "get kubernetes client")
 	}
 
-	cleanup, err := b.checkForConfigMap(client)
-	if err != nil {
-		return errors.Wrap(err, "check for config map")
+	if b.Timeouts.Total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Timeouts.Total)
+		defer cancel()
+	}
+
+	var cleanups cleanupStack
+	defer cleanups.run(util.Logger(ctx), b.Timeouts.Cleanup)
+
+	b.buildID = util.RandomID()
+
+	if b.RegistrySecret != "" {
+		b.credentialsSecretName = b.RegistrySecret //use pre-existing secret instead of uploading local credentials
+	} else {
+		if err := b.createCredentialsSecret(client, &cleanups); err != nil {
+			return nil, errors.Wrap(err, "creating credentials secret")
+		}
 	}
-	defer cleanup()
 
-	cleanup, err = b.generateContext()
+	err = b.runPhase(ctx, PhaseContext, b.Timeouts.Context, func(ctx context.Context) error {
+		return b.generateContext(ctx, &cleanups)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer cleanup()
 
-	pod := b.getKanikoPod()
-	b.Source.ModifyPod(pod)
+	b.podDeadline = b.activeDeadline(ctx)
+	pod, err := b.preparePod()
+	if err != nil {
+		return nil, err
+	}
 
+	cleanups.push(b.Source.Cleanup)
 	if err := b.Source.PrepareCredentials(); err != nil {
-		return errors.Wrap(err, "preparing credentials")
+		return nil, errors.Wrap(err, "preparing credentials")
 	}
 
 	if !b.Source.RequiresPod() {
-		if err := b.Source.UploadTar(pod, b.tarPath); err != nil {
-			return errors.Wrap(err, "uploading tar")
+		err := b.runPhase(ctx, PhaseUpload, b.Timeouts.Upload, func(ctx context.Context) error {
+			return b.Source.UploadTar(ctx, pod, b.tarPath)
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "uploading tar")
 		}
 	}
 
+	if ctx.Err() != nil {
+		return nil, b.contextError(ctx)
+	}
+
 	pods := client.CoreV1().Pods(b.Namespace)
 	pod, err = pods.Create(pod)
 	if err != nil {
-		return errors.Wrap(err, "creating kaniko pod")
+		return nil, errors.Wrap(err, "creating kaniko pod")
 	}
-	defer func() {
-		logrus.Info("Deleting build pod...")
+	cleanups.push(func(ctx context.Context) {
+		util.Logger(ctx).Info("Deleting build pod...")
 		err := pods.Delete(pod.Name, &metav1.DeleteOptions{
 			GracePeriodSeconds: new(int64),
 		})
 		if err != nil {
-			logrus.Error(err)
+			util.Logger(ctx).Error(err)
 		}
-	}()
+	})
+
+	//let the credentials be garbage collected with the pod in case kbuild gets killed
+	if err := kubernetes.SetPodOwnerReference(client, pod, b.buildIDSelector()); err != nil {
+		util.Logger(ctx).Warn(errors.Wrap(err, "setting owner reference of credentials"))
+	}
+
+	err = b.runPhase(ctx, PhasePodStart, b.Timeouts.PodStart, func(ctx context.Context) error {
+		if b.Source.RequiresPod() {
+			return kubernetes.WaitForPodInitialized(ctx, client, b.Namespace, pod.Name)
+		}
+		return kubernetes.WaitForPodStarted(ctx, client, b.Namespace, pod.Name)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "waiting for kaniko pod to start")
+	}
 
 	if b.Source.RequiresPod() {
-		if err := b.Source.UploadTar(pod, b.tarPath); err != nil {
-			return errors.Wrap(err, "uploading tar")
+		err := b.runPhase(ctx, PhaseUpload, b.Timeouts.Upload, func(ctx context.Context) error {
+			return b.Source.UploadTar(ctx, pod, b.tarPath)
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "uploading tar")
 		}
 	}
 
-	defer b.Source.Cleanup()
+	util.Logger(ctx).Info("Starting build...")
+	stopLogs := b.streamLogs(ctx, client, pod.Name)
+
+	var completed *v1.Pod
+	err = b.runPhase(ctx, PhaseBuild, b.Timeouts.Build, func(ctx context.Context) error {
+		completed, err = kubernetes.WaitForPodComplete(ctx, client, b.Namespace, pod.Name)
+		return err
+	})
+	stopLogs()
+	if err != nil {
+		return nil, errors.Wrap(err, "waiting for kaniko pod to complete")
+	}
+
+	result, err := getResult(completed)
+	if err != nil {
+		return nil, err
+	}
 
-	logrus.Info("Starting build...")
-	cancel := b.streamLogs(ctx, client, pod.Name)
+	if err := result.Err(); err != nil {
+		return result, err
+	}
 
-	finishChan := make(chan bool, 1)
+	util.Logger(ctx).Infof("Build succeeded in %s.", result.Duration())
+	return result, nil
+}
 
-	go func() {
-		if err := kubernetes.WaitForPodComplete(ctx, client, b.Namespace, pod.Name, finishChan); err != nil && err != wait.ErrWaitTimeout {
-			logrus.Error(errors.Wrap(err, "waiting for kaniko pod to complete"))
-		}
-	}()
-
-	select {
-	case <-ctx.Done():
-		cancel() //stop streaming logs
-		logrus.Infoln("Build was cancelled")
-	case <-finishChan:
-		cancel() //stop streaming logs
-		podStatus, err := pods.Get(pod.Name, metav1.GetOptions{})
-		if err == nil && podStatus.Status.ContainerStatuses[0].State.Terminated.Reason == "Error" { //build container exited with a non 0 code
-			return ErrorBuildFailed
-		}
+//runPhase runs a build phase with a context limited by the timeout of the phase.
+//Errors caused by a done context are replaced with ErrorCancelled or a TimeoutError.
+func (b Build) runPhase(ctx context.Context, phase string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	phaseCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		phaseCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-		logrus.Info("Build succeeded.")
+	err := fn(phaseCtx)
+	if err == nil {
+		return nil
 	}
 
-	return nil
+	switch {
+	case ctx.Err() != nil:
+		return b.contextError(ctx)
+	case phaseCtx.Err() == context.DeadlineExceeded:
+		return TimeoutError{Phase: phase, Timeout: timeout}
+	case errors.Cause(err) == kubernetes.ErrorPodDeadlineExceeded:
+		return TimeoutError{Phase: PhasePod, Timeout: b.podDeadline}
+	}
+	return err
 }
 
-func (b Build) checkForConfigMap(client *k8s.Clientset) (func(), error) {
-	configMaps := client.CoreV1().ConfigMaps(b.Namespace)
+//contextError returns ErrorCancelled or a TimeoutError depending on why the build context is done
+func (b Build) contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return TimeoutError{Phase: PhaseTotal, Timeout: b.Timeouts.Total}
+	}
+	return ErrorCancelled
+}
 
-	_, err := configMaps.Get(b.CredentialsMap.Name, metav1.GetOptions{})
-	if err != nil { //configmap is not present
-		_, err = configMaps.Create(b.CredentialsMap) //so we create a new one
-		if err != nil {
-			return nil, errors.Wrap(err, "creating configmap")
-		}
-	} else {
-		_, err := configMaps.Update(b.CredentialsMap) //otherwise update the existing configmap
-		if err != nil {
-			return nil, errors.Wrap(err, "updating configmap")
-		}
+//output returns the writer the build logs are written to, defaults to stdout
+func (b Build) output() io.Writer {
+	if b.Out == nil {
+		return os.Stdout
 	}
+	return b.Out
+}
+
+//createCredentialsSecret creates a uniquely named copy of the credentials secret for this build,
+//so concurrent builds in the same namespace don't interfere with each other
+func (b *Build) createCredentialsSecret(client *k8s.Clientset, cleanups *cleanupStack) error {
+	secrets := client.CoreV1().Secrets(b.Namespace)
 
-	return func() {
-		logrus.Infoln("Deleting credentials map")
-		if err := configMaps.Delete(b.CredentialsMap.Name, &metav1.DeleteOptions{}); err != nil {
-			logrus.Error(errors.Wrap(err, "deleting credentials configmap"))
+	secret := b.credentialsSecret()
+	if _, err := secrets.Create(secret); err != nil {
+		return err
+	}
+	b.credentialsSecretName = secret.Name
+
+	cleanups.push(func(ctx context.Context) {
+		util.Logger(ctx).Infoln("Deleting credentials secret")
+		//the secret is owned by the pod, so it may already have been garbage collected together with it
+		if err := secrets.Delete(secret.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			util.Logger(ctx).Error(errors.Wrap(err, "deleting credentials secret"))
 		}
-	}, nil
+	})
+	return nil
 }
 
-func (b *Build) generateContext() (func(), error) {
-	b.tarPath = filepath.Join(os.TempDir(), fmt.Sprintf("context-%s.tar.gz", util.RandomID()))
+//credentialsSecret returns the copy of the credentials secret which is created for this build
+func (b Build) credentialsSecret() *v1.Secret {
+	secret := b.CredentialsSecret.DeepCopy()
+	secret.Name = fmt.Sprintf("%s-%s", constants.CredentialsSecretName, b.buildID)
+	if secret.Labels == nil {
+		secret.Labels = make(map[string]string)
+	}
+	secret.Labels[constants.BuildIDLabel] = b.buildID
+	secret.Annotations = b.annotations()
+	return secret
+}
+
+//annotations returns the annotations identifying the build and its creator, they are added to all objects of the build
+func (b Build) annotations() map[string]string {
+	annotations := map[string]string{
+		constants.CreatedByAnnotation: util.Creator(),
+	}
+	if b.Name != "" {
+		annotations[constants.BuildNameAnnotation] = b.Name
+	}
+	return annotations
+}
+
+//buildIDSelector returns a label selector for all objects belonging to this build
+func (b Build) buildIDSelector() string {
+	return fmt.Sprintf("%s=%s", constants.BuildIDLabel, b.buildID)
+}
+
+func (b *Build) generateContext(ctx context.Context, cleanups *cleanupStack) error {
+	b.tarPath = filepath.Join(os.TempDir(), contextTarName(util.RandomID()))
 
 	file, err := os.Create(b.tarPath)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating tar file")
+		return errors.Wrap(err, "creating tar file")
 	}
 	defer file.Close()
 
-	err = docker.CreateContextFromWorkingDir(b.WorkDir, b.DockerfilePath, file, b.BuildArgs)
+	cleanups.push(func(ctx context.Context) {
+		if err := os.Remove(b.tarPath); err != nil {
+			util.Logger(ctx).Error(err)
+		}
+	})
+
+	err = docker.CreateContextFromWorkingDir(b.WorkDir, b.DockerfilePath, b.Executor.Target, b.ContextMode, util.ContextWriter{Ctx: ctx, Writer: file}, b.BuildArgs)
 	if err != nil {
-		return nil, errors.Wrap(err, "generating context")
+		return errors.Wrap(err, "generating context")
 	}
 
-	return func() {
-		if err := os.Remove(b.tarPath); err != nil {
-			logrus.Error(err)
-		}
-	}, nil
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "reading context size")
+	}
+	util.Logger(ctx).Infof("Sending build context of %s in %s context mode", util.FormatBytes(info.Size()), b.contextMode())
+
+	return nil
+}
+
+//contextMode returns the build context mode, defaults to constants.ContextModeReferenced
+func (b Build) contextMode() string {
+	if b.ContextMode == "" {
+		return constants.ContextModeReferenced
+	}
+	return b.ContextMode
+}
+
+//contextTarName returns the file name of the build context tar, the prefix allows "kbuild gc" to find left behind contexts
+func contextTarName(id string) string {
+	return fmt.Sprintf("%s%s.tar.gz", constants.ContextObjectPrefix, id)
 }
@@ -0,0 +1,68 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"context"
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+//DefaultCleanupTimeout is the max duration spent on deleting the resources of a build if no cleanup timeout is set
+const DefaultCleanupTimeout = 30 * time.Second
+
+//cleanupStack collects the functions deleting the resources of a build
+type cleanupStack []func(ctx context.Context)
+
+func (s *cleanupStack) push(fn func(ctx context.Context)) {
+	*s = append(*s, fn)
+}
+
+//run calls all cleanup functions in reverse order with a fresh context carrying the log entry, so the resources are deleted
+//even if the build was cancelled. Each function gets an equal share of the timeout before the next one is started,
+//so a blocking function can't prevent the others from running. Returns at the latest once the timeout is over.
+func (s *cleanupStack) run(log *logrus.Entry, timeout time.Duration) {
+	fns := *s
+	if len(fns) == 0 {
+		return
+	}
+	if timeout <= 0 {
+		timeout = DefaultCleanupTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(util.WithLogger(context.Background(), log), timeout)
+	defer cancel()
+
+	share := timeout / time.Duration(len(fns))
+	for i := len(fns) - 1; i >= 0; i-- {
+		done := make(chan struct{})
+		go func(fn func(ctx context.Context)) {
+			defer close(done)
+			fn(ctx)
+		}(fns[i])
+
+		timer := time.NewTimer(share)
+		select {
+		case <-done:
+		case <-timer.C:
+			log.Warnf("Cleanup step didn't finish within %s, some resources of the build might be left behind", share)
+		}
+		timer.Stop()
+	}
+}
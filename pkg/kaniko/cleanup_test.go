@@ -0,0 +1,106 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var testLog = logrus.NewEntry(logrus.StandardLogger())
+
+//recorder records the order cleanup functions are called in
+type recorder struct {
+	mu     sync.Mutex
+	called []string
+}
+
+func (r *recorder) fn(name string) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.called = append(r.called, name)
+	}
+}
+
+func (r *recorder) calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.called...)
+}
+
+func TestCleanupStackOrder(t *testing.T) {
+	var r recorder
+	var s cleanupStack
+	s.push(r.fn("tar"))
+	s.push(r.fn("secret"))
+	s.push(r.fn("pod"))
+
+	s.run(testLog, time.Second)
+
+	expected := []string{"pod", "secret", "tar"}
+	if calls := r.calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected cleanups %v but got %v", expected, calls)
+	}
+}
+
+func TestCleanupStackDefaultTimeout(t *testing.T) {
+	var deadline time.Time
+	var s cleanupStack
+	s.push(func(ctx context.Context) {
+		deadline, _ = ctx.Deadline()
+	})
+
+	start := time.Now()
+	s.run(testLog, 0)
+
+	if remaining := deadline.Sub(start); remaining < DefaultCleanupTimeout-time.Second || remaining > DefaultCleanupTimeout+time.Second {
+		t.Errorf("Expected a deadline of %s but got %s", DefaultCleanupTimeout, remaining)
+	}
+}
+
+func TestCleanupStackBlocking(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	var r recorder
+	var s cleanupStack
+	s.push(r.fn("tar"))
+	s.push(func(ctx context.Context) {
+		r.fn("blocking")(ctx)
+		<-unblock //ignores the context like a stuck api call
+	})
+	s.push(r.fn("pod"))
+
+	timeout := 300 * time.Millisecond
+	start := time.Now()
+	s.run(testLog, timeout)
+
+	if elapsed := time.Since(start); elapsed > timeout+200*time.Millisecond {
+		t.Errorf("Expected cleanup to return within %s but took %s", timeout, elapsed)
+	}
+
+	expected := []string{"pod", "blocking", "tar"}
+	if calls := r.calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected cleanups %v but got %v", expected, calls)
+	}
+}
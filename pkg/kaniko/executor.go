@@ -0,0 +1,202 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Snapshot modes of the Kaniko executor
+const (
+	SnapshotModeFull = "full"
+	SnapshotModeTime = "time"
+	SnapshotModeRedo = "redo"
+)
+
+//ExecutorOptions contains the flags passed to the Kaniko executor
+type ExecutorOptions struct {
+	//Target is the stage of a multi-stage Dockerfile to build
+	Target string
+	//SnapshotMode is one of full, time or redo
+	SnapshotMode   string
+	SingleSnapshot bool
+	Reproducible   bool
+	//CacheTTL is the expiration of cached layers, only used if caching is enabled
+	CacheTTL       time.Duration
+	Insecure       bool
+	SkipTLSVerify  bool
+	RegistryMirror string
+	Labels         map[string]string
+	NoPush         bool
+	//TarPath and DigestFile are paths inside the Kaniko container, mount a volume with the pod overlay to keep them
+	TarPath    string
+	DigestFile string
+	UseNewRun  bool
+	//ExtraArgs are passed to the executor as is, e.g. --verbosity=debug
+	ExtraArgs []string
+}
+
+//managedFlags are the executor flags set by kbuild itself, they can't be passed as extra args.
+//Flags with a typed option map to the kbuild flag and config field setting them, so every setting has exactly one path.
+var managedFlags = map[string]string{
+	"dockerfile":      "",
+	"context":         "",
+	"destination":     "",
+	"build-arg":       "kbuild --build-arg / buildArgs in kbuild.yaml",
+	"cache":           "kbuild --cache / cache in kbuild.yaml",
+	"cache-repo":      "kbuild --cache-repo / cacheRepo in kbuild.yaml",
+	"cache-ttl":       "kbuild --cache-ttl / kaniko.cacheTTL in kbuild.yaml",
+	"digest-file":     "kbuild --digest-file / kaniko.digestFile in kbuild.yaml",
+	"insecure":        "kbuild --insecure / kaniko.insecure in kbuild.yaml",
+	"label":           "kbuild --label / kaniko.labels in kbuild.yaml",
+	"no-push":         "kbuild --no-push / kaniko.noPush in kbuild.yaml",
+	"registry-mirror": "kbuild --registry-mirror / kaniko.registryMirror in kbuild.yaml",
+	"reproducible":    "kbuild --reproducible / kaniko.reproducible in kbuild.yaml",
+	"single-snapshot": "kbuild --single-snapshot / kaniko.singleSnapshot in kbuild.yaml",
+	"skip-tls-verify": "kbuild --skip-tls-verify / kaniko.skipTLSVerify in kbuild.yaml",
+	"snapshotMode":    "kbuild --snapshot-mode / kaniko.snapshotMode in kbuild.yaml",
+	"tarPath":         "kbuild --tar-path / kaniko.tarPath in kbuild.yaml",
+	"target":          "kbuild --target / kaniko.target in kbuild.yaml",
+	"use-new-run":     "kbuild --use-new-run / kaniko.useNewRun in kbuild.yaml",
+}
+
+//knownFlags are all other flags of the Kaniko executor
+var knownFlags = map[string]bool{
+	"cache-dir":                       true,
+	"cleanup":                         true,
+	"context-sub-path":                true,
+	"force":                           true,
+	"image-name-with-digest-file":     true,
+	"image-name-tag-with-digest-file": true,
+	"ignore-path":                     true,
+	"ignore-var-run":                  true,
+	"insecure-pull":                   true,
+	"insecure-registry":               true,
+	"log-format":                      true,
+	"log-timestamp":                   true,
+	"oci-layout-path":                 true,
+	"push-retry":                      true,
+	"registry-certificate":            true,
+	"skip-tls-verify-pull":            true,
+	"skip-tls-verify-registry":        true,
+	"skip-unused-stages":              true,
+	"verbosity":                       true,
+	"whitelist-var-run":               true,
+}
+
+//Validate checks the snapshot mode, the labels and the names of the extra args
+func (o ExecutorOptions) Validate() error {
+	switch o.SnapshotMode {
+	case "", SnapshotModeFull, SnapshotModeTime, SnapshotModeRedo:
+	default:
+		return errors.Errorf("unknown snapshot mode %q, must be one of %s, %s, %s", o.SnapshotMode, SnapshotModeFull, SnapshotModeTime, SnapshotModeRedo)
+	}
+
+	if o.CacheTTL < 0 {
+		return errors.New("cache ttl must not be negative")
+	}
+
+	for key := range o.Labels {
+		if key == "" {
+			return errors.New("label key must not be empty")
+		}
+	}
+
+	for _, arg := range o.ExtraArgs {
+		if err := validateExtraArg(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//validateExtraArg makes sure the arg is a known executor flag in the format --name[=value]
+func validateExtraArg(arg string) error {
+	if !strings.HasPrefix(arg, "--") {
+		return errors.Errorf("invalid Kaniko arg %q, expected --name[=value]", arg)
+	}
+
+	flag := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)[0]
+	if option, ok := managedFlags[flag]; ok {
+		if option == "" {
+			return errors.Errorf("Kaniko arg --%s is set by kbuild and can't be passed directly", flag)
+		}
+		return errors.Errorf("Kaniko arg --%s is set by kbuild, use %s instead", flag, option)
+	}
+	if !knownFlags[flag] {
+		return errors.Errorf("unknown Kaniko arg --%s", flag)
+	}
+	return nil
+}
+
+//args returns the executor arguments of the options, extra args are appended last
+func (o ExecutorOptions) args() []string {
+	var args []string
+
+	values := []struct {
+		flag  string
+		value string
+	}{
+		{"target", o.Target},
+		{"snapshotMode", o.SnapshotMode},
+		{"registry-mirror", o.RegistryMirror},
+		{"tarPath", o.TarPath},
+		{"digest-file", o.DigestFile},
+	}
+	for _, v := range values {
+		if v.value != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", v.flag, v.value))
+		}
+	}
+
+	if o.CacheTTL > 0 {
+		args = append(args, fmt.Sprintf("--cache-ttl=%s", o.CacheTTL))
+	}
+
+	flags := []struct {
+		flag    string
+		enabled bool
+	}{
+		{"single-snapshot", o.SingleSnapshot},
+		{"reproducible", o.Reproducible},
+		{"insecure", o.Insecure},
+		{"skip-tls-verify", o.SkipTLSVerify},
+		{"no-push", o.NoPush},
+		{"use-new-run", o.UseNewRun},
+	}
+	for _, f := range flags {
+		if f.enabled {
+			args = append(args, "--"+f.flag)
+		}
+	}
+
+	keys := make([]string, 0, len(o.Labels))
+	for key := range o.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) //keep the args stable for --dry-run
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("--label=%s=%s", key, o.Labels[key]))
+	}
+
+	return append(args, o.ExtraArgs...)
+}
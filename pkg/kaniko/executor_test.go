@@ -0,0 +1,81 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutorArgs(t *testing.T) {
+	opts := ExecutorOptions{
+		Target:       "release",
+		SnapshotMode: SnapshotModeRedo,
+		CacheTTL:     6 * time.Hour,
+		Reproducible: true,
+		NoPush:       true,
+		Labels:       map[string]string{"version": "1.0", "maintainer": "kbuild"},
+		ExtraArgs:    []string{"--verbosity=debug"},
+	}
+
+	expected := []string{
+		"--target=release",
+		"--snapshotMode=redo",
+		"--cache-ttl=6h0m0s",
+		"--reproducible",
+		"--no-push",
+		"--label=maintainer=kbuild",
+		"--label=version=1.0",
+		"--verbosity=debug",
+	}
+	if args := opts.args(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %s but got %s", strings.Join(expected, " "), strings.Join(args, " "))
+	}
+}
+
+func TestValidateExecutorOptions(t *testing.T) {
+	tests := []struct {
+		opts        ExecutorOptions
+		expectedErr string
+	}{
+		{opts: ExecutorOptions{SnapshotMode: SnapshotModeTime, ExtraArgs: []string{"--verbosity=debug", "--cleanup"}}},
+		{opts: ExecutorOptions{SnapshotMode: "fast"}, expectedErr: `unknown snapshot mode "fast"`},
+		{opts: ExecutorOptions{ExtraArgs: []string{"--verbose"}}, expectedErr: "unknown Kaniko arg --verbose"},
+		{opts: ExecutorOptions{ExtraArgs: []string{"--destination=other:latest"}}, expectedErr: "--destination is set by kbuild"},
+		{opts: ExecutorOptions{ExtraArgs: []string{"--target=release"}}, expectedErr: "--target is set by kbuild, use kbuild --target / kaniko.target in kbuild.yaml instead"},
+		{opts: ExecutorOptions{ExtraArgs: []string{"--snapshotMode=redo"}}, expectedErr: "use kbuild --snapshot-mode / kaniko.snapshotMode in kbuild.yaml instead"},
+		{opts: ExecutorOptions{ExtraArgs: []string{"--cache-ttl=1h"}}, expectedErr: "use kbuild --cache-ttl / kaniko.cacheTTL in kbuild.yaml instead"},
+		{opts: ExecutorOptions{ExtraArgs: []string{"--label=a=b"}}, expectedErr: "use kbuild --label / kaniko.labels in kbuild.yaml instead"},
+		{opts: ExecutorOptions{ExtraArgs: []string{"verbosity=debug"}}, expectedErr: "expected --name[=value]"},
+	}
+
+	for _, test := range tests {
+		err := test.opts.Validate()
+		if test.expectedErr == "" {
+			if err != nil {
+				t.Errorf("Expected no error but got %s", err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("Expected error %s but got %v", test.expectedErr, err)
+		}
+	}
+}
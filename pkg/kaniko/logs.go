@@ -20,7 +20,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,9 +29,13 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+//logDrainTimeout is the max duration to wait for the remaining logs after the build is done
+const logDrainTimeout = 5 * time.Second
+
 //code used from github.com/GoogleContainerTools/skaffold
 func (b Build) streamLogs(ctx context.Context, clientset *kubernetes.Clientset, podName string) func() {
 	pods := clientset.CoreV1().Pods(b.Namespace)
+	ctx, cancel := context.WithCancel(ctx)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -53,7 +56,7 @@ func (b Build) streamLogs(ctx context.Context, clientset *kubernetes.Clientset,
 				continue
 			}
 
-			written, _ := io.Copy(os.Stdout, readCloser)
+			written, _ := io.Copy(b.output(), readCloser)
 			atomic.AddInt64(&bytesRead, written)
 			return
 		}
@@ -61,14 +64,27 @@ func (b Build) streamLogs(ctx context.Context, clientset *kubernetes.Clientset,
 
 	return func() {
 		atomic.StoreInt32(&retry, 0)
-		wg.Wait()
+
+		//the stream ends by itself once the container terminated, otherwise it's closed to not block the cleanup
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(logDrainTimeout):
+			cancel()
+			<-done
+		}
+		cancel()
 
 		if atomic.LoadInt64(&bytesRead) == 0 {
 			logs, err := pods.GetLogs(podName, &v1.PodLogOptions{
 				Container: constants.KanikoContainerName,
 			}).DoRaw()
 			if err == nil {
-				fmt.Println(string(logs))
+				fmt.Fprintln(b.output(), string(logs))
 			}
 		}
 	}
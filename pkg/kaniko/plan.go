@@ -0,0 +1,160 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/docker"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/cedrickring/kbuild/pkg/util"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//DryRunBuildID is the placeholder of the build id in rendered manifests
+const DryRunBuildID = "dry-run"
+
+//Plan contains everything a build would create, it is rendered by RenderPlan without contacting the cluster
+type Plan struct {
+	Name    string       `json:"name,omitempty"`
+	Context ContextPlan  `json:"context"`
+	Pod     *v1.Pod      `json:"pod"`
+	Secrets []*v1.Secret `json:"secrets,omitempty"`
+}
+
+//ContextPlan describes the build context of a build
+type ContextPlan struct {
+	WorkDir    string `json:"workDir"`
+	Dockerfile string `json:"dockerfile"`
+	Mode       string `json:"mode"`
+	//Files are the files and directories sent as build context, directories are included recursively
+	Files []string `json:"files"`
+	//TarSize is the size of the gzipped context tar in bytes
+	TarSize int64 `json:"tarSize"`
+	//Sizes compares the files and their uncompressed size of all context modes
+	Sizes map[string]docker.ContextStats `json:"sizes"`
+	//Upload is the destination the context is uploaded to
+	Upload string `json:"upload"`
+}
+
+//RenderPlan returns the build context, the pod and the secrets as they would be created by StartBuild
+//without contacting the cluster. The build id is replaced by DryRunBuildID and the values of all secrets are redacted.
+func (b Build) RenderPlan() (*Plan, error) {
+	b.buildID = DryRunBuildID
+	if b.RegistrySecret != "" {
+		b.credentialsSecretName = b.RegistrySecret
+	} else {
+		b.credentialsSecretName = fmt.Sprintf("%s-%s", constants.CredentialsSecretName, b.buildID)
+	}
+
+	files, err := docker.GetContextPaths(b.WorkDir, b.DockerfilePath, b.Executor.Target, b.contextMode(), b.BuildArgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting context files")
+	}
+
+	var tar util.CountingWriter
+	if err := docker.CreateContextFromWorkingDir(b.WorkDir, b.DockerfilePath, b.Executor.Target, b.contextMode(), &tar, b.BuildArgs); err != nil {
+		return nil, errors.Wrap(err, "generating context")
+	}
+
+	sizes, err := b.contextStats()
+	if err != nil {
+		return nil, errors.Wrap(err, "comparing context modes")
+	}
+
+	ctx := context.Background()
+	if b.Timeouts.Total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Timeouts.Total)
+		defer cancel()
+	}
+	b.podDeadline = b.activeDeadline(ctx)
+
+	pod, err := b.preparePod()
+	if err != nil {
+		return nil, err
+	}
+	sourcePlan := b.Source.Plan(pod, contextTarName(b.buildID))
+
+	pod.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+	pod.Namespace = b.Namespace
+	b.redactBuildArgs(pod)
+
+	var secrets []*v1.Secret
+	if b.RegistrySecret == "" {
+		if b.CredentialsSecret == nil {
+			b.CredentialsSecret = docker.GetCredentialsAsSecret(nil) //the credentials are redacted anyway
+		}
+		secrets = append(secrets, b.credentialsSecret())
+	}
+	secrets = append(secrets, sourcePlan.Secrets...)
+
+	for i, secret := range secrets {
+		secrets[i] = kubernetes.RedactSecret(secret)
+		secrets[i].TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+		secrets[i].Namespace = b.Namespace
+	}
+
+	return &Plan{
+		Name: b.Name,
+		Context: ContextPlan{
+			WorkDir:    b.WorkDir,
+			Dockerfile: b.DockerfilePath,
+			Mode:       b.contextMode(),
+			Files:      files,
+			TarSize:    tar.Count,
+			Sizes:      sizes,
+			Upload:     sourcePlan.Upload,
+		},
+		Pod:     pod,
+		Secrets: secrets,
+	}, nil
+}
+
+//redactBuildArgs replaces the values of the redacted build args in the container args, like kubernetes.RedactSecret
+//does for secrets, so values read from the environment or dotenv files aren't printed
+func (b Build) redactBuildArgs(pod *v1.Pod) {
+	for _, key := range b.RedactedBuildArgs {
+		prefix := fmt.Sprintf("--build-arg=%s=", key)
+		for i, container := range pod.Spec.Containers {
+			for j, arg := range container.Args {
+				if strings.HasPrefix(arg, prefix) {
+					pod.Spec.Containers[i].Args[j] = prefix + kubernetes.RedactedValue
+				}
+			}
+		}
+	}
+}
+
+//contextStats returns the number of files and the size of the build context in all context modes.
+//It walks the work dir once per mode, so it is only used for --dry-run and not for real builds.
+func (b Build) contextStats() (map[string]docker.ContextStats, error) {
+	stats := make(map[string]docker.ContextStats)
+	for _, mode := range []string{constants.ContextModeReferenced, constants.ContextModeFull} {
+		s, err := docker.GetContextStats(b.WorkDir, b.DockerfilePath, b.Executor.Target, mode, b.BuildArgs)
+		if err != nil {
+			return nil, err
+		}
+		stats[mode] = s
+	}
+	return stats, nil
+}
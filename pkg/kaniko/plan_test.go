@@ -0,0 +1,97 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/kaniko/source"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRenderPlan(t *testing.T) {
+	b := Build{
+		Name:           "app",
+		ImageTags:      []string{"my.registry.com/app:latest"},
+		WorkDir:        "../docker/test",
+		DockerfilePath: "Dockerfile.test",
+		Namespace:      "builds",
+		Source:         &source.GCS{Namespace: "builds", Bucket: "contexts"},
+		BuildArgs:      []string{"TOKEN=secret", "VERSION=1.0"},
+	}
+	b.RedactedBuildArgs = []string{"TOKEN"}
+
+	plan, err := b.RenderPlan()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expectedFiles := []string{"../docker/test/test.go", "../docker/test/Dockerfile.test"}
+	if !reflect.DeepEqual(plan.Context.Files, expectedFiles) {
+		t.Errorf("Expected files %s but got %s", strings.Join(expectedFiles, ","), strings.Join(plan.Context.Files, ","))
+	}
+	if plan.Context.TarSize == 0 {
+		t.Error("Expected tar size to be set")
+	}
+	if plan.Context.Mode != constants.ContextModeReferenced {
+		t.Errorf("Expected context mode %s but got %s", constants.ContextModeReferenced, plan.Context.Mode)
+	}
+	referenced, full := plan.Context.Sizes[constants.ContextModeReferenced], plan.Context.Sizes[constants.ContextModeFull]
+	if referenced.Files != len(expectedFiles) || full.Files <= referenced.Files {
+		t.Errorf("Expected %d referenced files and more files in the full context but got %+v", len(expectedFiles), plan.Context.Sizes)
+	}
+
+	expectedUpload := "gs://contexts/context-dry-run.tar.gz"
+	if plan.Context.Upload != expectedUpload {
+		t.Errorf("Expected upload %s but got %s", expectedUpload, plan.Context.Upload)
+	}
+
+	if plan.Pod.Namespace != "builds" || plan.Pod.Labels[constants.BuildIDLabel] != DryRunBuildID {
+		t.Errorf("Expected pod in namespace builds with build id %s but got %+v", DryRunBuildID, plan.Pod.ObjectMeta)
+	}
+	args := strings.Join(plan.Pod.Spec.Containers[0].Args, " ")
+	if !strings.Contains(args, "--context="+expectedUpload) {
+		t.Errorf("Expected context argument in %s", args)
+	}
+	if !strings.Contains(args, "--build-arg=TOKEN="+kubernetes.RedactedValue) || strings.Contains(args, "secret") {
+		t.Errorf("Expected build arg TOKEN to be redacted in %s", args)
+	}
+	if !strings.Contains(args, "--build-arg=VERSION=1.0") {
+		t.Errorf("Expected build arg VERSION in %s", args)
+	}
+
+	if len(plan.Secrets) != 2 {
+		t.Fatalf("Expected credentials and gcs secret but got %d secrets", len(plan.Secrets))
+	}
+	for _, secret := range plan.Secrets {
+		if len(secret.Data) != 0 || len(secret.StringData) == 0 {
+			t.Errorf("Expected data of secret %s to be redacted", secret.Name)
+		}
+		for key, value := range secret.StringData {
+			if value != kubernetes.RedactedValue {
+				t.Errorf("Expected key %s of secret %s to be redacted", key, secret.Name)
+			}
+		}
+	}
+	if plan.Secrets[0].Type != v1.SecretTypeDockerConfigJson {
+		t.Errorf("Expected credentials secret of type %s but got %s", v1.SecretTypeDockerConfigJson, plan.Secrets[0].Type)
+	}
+}
@@ -20,26 +20,49 @@ import (
 	"fmt"
 
 	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/docker"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+//PodOptions contains the images, resources and scheduling constraints of the build pod
+type PodOptions struct {
+	//ExecutorImage is the Kaniko executor image, defaults to constants.DefaultExecutorImage
+	ExecutorImage string
+	//InitImage replaces the image of the init containers added by the build context source
+	InitImage string
+	//ImagePullSecrets are the names of the secrets used to pull the executor and init images
+	ImagePullSecrets []string
+	//Resources of the Kaniko container
+	Resources v1.ResourceRequirements
+	//InitResources of the init containers added by the build context source
+	InitResources      v1.ResourceRequirements
+	NodeSelector       map[string]string
+	Tolerations        []v1.Toleration
+	Affinity           *v1.Affinity
+	PriorityClassName  string
+	ServiceAccountName string
+}
+
 func (b Build) getKanikoPod() *v1.Pod {
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "kaniko-",
 			Labels: map[string]string{
-				"builder": "kaniko",
+				constants.BuilderLabel: "kaniko",
+				constants.BuildIDLabel: b.buildID,
 			},
+			Annotations: b.annotations(),
 		},
 		Spec: v1.PodSpec{
 			Containers: []v1.Container{
 				{
 					Name:  constants.KanikoContainerName,
-					Image: "gcr.io/kaniko-project/executor",
+					Image: b.Pod.executorImage(),
 					Args: []string{
-						"--dockerfile=" + b.DockerfilePath,
+						"--dockerfile=" + docker.ContextDockerfilePath(b.WorkDir, b.DockerfilePath),
 					},
 					VolumeMounts: []v1.VolumeMount{
 						{
@@ -49,14 +72,19 @@ func (b Build) getKanikoPod() *v1.Pod {
 					},
 				},
 			},
-			RestartPolicy: v1.RestartPolicyNever,
+			RestartPolicy:         v1.RestartPolicyNever,
+			ActiveDeadlineSeconds: activeDeadlineSeconds(b.podDeadline), //stop the build even if kbuild gets killed
 			Volumes: []v1.Volume{
 				{
 					Name: "docker-config",
 					VolumeSource: v1.VolumeSource{
-						ConfigMap: &v1.ConfigMapVolumeSource{
-							LocalObjectReference: v1.LocalObjectReference{
-								Name: constants.ConfigMapName,
+						Secret: &v1.SecretVolumeSource{
+							SecretName: b.credentialsSecretName,
+							Items: []v1.KeyToPath{
+								{
+									Key:  v1.DockerConfigJsonKey,
+									Path: "config.json",
+								},
 							},
 						},
 					},
@@ -90,5 +118,88 @@ func (b Build) getKanikoPod() *v1.Pod {
 		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, "--cache=true", fmt.Sprintf("--cache-repo=%s", cacheRepo))
 	}
 
+	pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, b.Executor.args()...)
+
 	return pod
 }
+
+//executorImage returns the configured executor image or the default one
+func (o PodOptions) executorImage() string {
+	if o.ExecutorImage == "" {
+		return constants.DefaultExecutorImage
+	}
+	return o.ExecutorImage
+}
+
+//applyPodOptions sets the init images and resources of all containers and the scheduling constraints of the pod.
+//It has to be called after the source modified the pod, so its init containers are included.
+func (b Build) applyPodOptions(pod *v1.Pod) {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == constants.KanikoContainerName {
+			pod.Spec.Containers[i].Resources = b.Pod.Resources
+		}
+	}
+	for i := range pod.Spec.InitContainers {
+		if b.Pod.InitImage != "" {
+			pod.Spec.InitContainers[i].Image = b.Pod.InitImage
+		}
+		pod.Spec.InitContainers[i].Resources = b.Pod.InitResources
+	}
+	for _, secret := range b.Pod.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, v1.LocalObjectReference{Name: secret})
+	}
+
+	pod.Spec.NodeSelector = b.Pod.NodeSelector
+	pod.Spec.Tolerations = b.Pod.Tolerations
+	pod.Spec.Affinity = b.Pod.Affinity
+	pod.Spec.PriorityClassName = b.Pod.PriorityClassName
+	pod.Spec.ServiceAccountName = b.Pod.ServiceAccountName
+}
+
+//preparePod returns the build pod with the modifications of the source, the pod options and the pod overlay applied
+func (b Build) preparePod() (*v1.Pod, error) {
+	pod := b.getKanikoPod()
+	b.Source.ModifyPod(pod)
+	b.applyPodOptions(pod)
+
+	if b.PodOverlay == nil {
+		return pod, nil
+	}
+
+	if err := b.PodOverlay.Apply(pod); err != nil {
+		return nil, errors.Wrap(err, "applying pod overlay")
+	}
+	if err := b.validatePod(pod); err != nil {
+		return nil, errors.Wrap(err, "invalid pod after applying pod overlay")
+	}
+	return pod, nil
+}
+
+//validatePod makes sure the pod can still be run and cleaned up by kbuild after applying the pod overlay
+func (b Build) validatePod(pod *v1.Pod) error {
+	if pod.Labels[constants.BuildIDLabel] != b.buildID {
+		return errors.Errorf("label %s must not be changed", constants.BuildIDLabel)
+	}
+	if pod.Spec.RestartPolicy != v1.RestartPolicyNever {
+		return errors.Errorf("restartPolicy must be %s", v1.RestartPolicyNever)
+	}
+
+	found := false
+	for _, container := range pod.Spec.Containers {
+		if container.Name == constants.KanikoContainerName {
+			found = true
+		}
+		if container.Image == "" {
+			return errors.Errorf("container %s has no image", container.Name)
+		}
+	}
+	if !found {
+		return errors.Errorf("container %s must not be removed", constants.KanikoContainerName)
+	}
+
+	if b.Source.RequiresPod() && len(pod.Spec.InitContainers) == 0 {
+		return errors.New("init container of the build context source must not be removed")
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+//Errors returned by StartBuild, use errors.Cause to compare them
+var (
+	//ErrorBuildFailed is an error for a failed build
+	ErrorBuildFailed = errors.New("build failed")
+	//ErrorOOMKilled is returned if the build container ran out of memory
+	ErrorOOMKilled = errors.New("build container was OOMKilled")
+	//ErrorEvicted is returned if the build pod was evicted from its node
+	ErrorEvicted = kubernetes.ErrorPodEvicted
+	//ErrorCancelled is returned if the build was cancelled
+	ErrorCancelled = errors.New("build was cancelled")
+	//ErrorTimeout is returned if the build didn't finish in time
+	ErrorTimeout = errors.New("build timed out")
+)
+
+//Result contains the outcome of the Kaniko build container
+type Result struct {
+	ExitCode   int32
+	Reason     string
+	Message    string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+//Duration returns how long the build container was running
+func (r Result) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+//getResult reads the termination state of the Kaniko container of the completed pod
+func getResult(pod *v1.Pod) (*Result, error) {
+	if pod.Status.Reason == "DeadlineExceeded" {
+		return nil, errors.Wrap(ErrorTimeout, pod.Status.Message)
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != constants.KanikoContainerName {
+			continue
+		}
+
+		terminated := status.State.Terminated
+		if terminated == nil {
+			return nil, errors.Errorf("container %s has not terminated", status.Name)
+		}
+
+		return &Result{
+			ExitCode:   terminated.ExitCode,
+			Reason:     terminated.Reason,
+			Message:    terminated.Message,
+			StartedAt:  terminated.StartedAt.Time,
+			FinishedAt: terminated.FinishedAt.Time,
+		}, nil
+	}
+
+	return nil, errors.Errorf("pod %s has no status for container %s", pod.Name, constants.KanikoContainerName)
+}
+
+//Err returns the typed error matching the termination state or nil if the build succeeded
+func (r Result) Err() error {
+	switch {
+	case r.Reason == "OOMKilled":
+		return ErrorOOMKilled
+	case r.Reason == "DeadlineExceeded":
+		return ErrorTimeout
+	case r.ExitCode != 0:
+		if r.Message != "" {
+			return errors.Wrapf(ErrorBuildFailed, "exit code %d: %s", r.ExitCode, r.Message)
+		}
+		return errors.Wrapf(ErrorBuildFailed, "exit code %d", r.ExitCode)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func terminatedPod(exitCode int32, reason, message string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kaniko"},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "sidecar", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+				{
+					Name:  constants.KanikoContainerName,
+					State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason, Message: message}},
+				},
+			},
+		},
+	}
+}
+
+func TestGetResult(t *testing.T) {
+	tests := []struct {
+		name          string
+		pod           *v1.Pod
+		expectedCause error
+		expectedErr   string
+	}{
+		{
+			name: "succeeded",
+			pod:  terminatedPod(0, "Completed", ""),
+		},
+		{
+			name:          "failed",
+			pod:           terminatedPod(1, "Error", "error building image"),
+			expectedCause: ErrorBuildFailed,
+			expectedErr:   "exit code 1: error building image",
+		},
+		{
+			name:          "failed without message",
+			pod:           terminatedPod(2, "Error", ""),
+			expectedCause: ErrorBuildFailed,
+			expectedErr:   "exit code 2",
+		},
+		{
+			name:          "oom killed",
+			pod:           terminatedPod(137, "OOMKilled", ""),
+			expectedCause: ErrorOOMKilled,
+		},
+		{
+			name:          "container deadline exceeded",
+			pod:           terminatedPod(137, "DeadlineExceeded", ""),
+			expectedCause: ErrorTimeout,
+		},
+		{
+			name:          "pod deadline exceeded",
+			pod:           &v1.Pod{Status: v1.PodStatus{Phase: v1.PodFailed, Reason: "DeadlineExceeded", Message: "Pod was active on the node longer than the specified deadline"}},
+			expectedCause: ErrorTimeout,
+			expectedErr:   "longer than the specified deadline",
+		},
+		{
+			name:        "missing status",
+			pod:         &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kaniko"}},
+			expectedErr: "pod kaniko has no status for container " + constants.KanikoContainerName,
+		},
+		{
+			name: "not terminated",
+			pod: &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: constants.KanikoContainerName, State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			}}},
+			expectedErr: "has not terminated",
+		},
+	}
+
+	for _, test := range tests {
+		result, err := getResult(test.pod)
+		if err == nil {
+			err = result.Err()
+		}
+
+		if test.expectedErr == "" && test.expectedCause == nil {
+			if err != nil {
+				t.Errorf("%s: expected no error but got %s", test.name, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: expected an error but got none", test.name)
+			continue
+		}
+		if test.expectedCause != nil && errors.Cause(err) != test.expectedCause {
+			t.Errorf("%s: expected cause %s but got %s", test.name, test.expectedCause, err)
+		}
+		if !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("%s: expected error %s but got %s", test.name, test.expectedErr, err)
+		}
+	}
+}
@@ -25,10 +25,12 @@ import (
 	"path/filepath"
 
 	"cloud.google.com/go/storage"
+	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/cedrickring/kbuild/pkg/util"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -38,37 +40,51 @@ const credentialsSecretName = "kaniko-gcs-secret"
 type GCS struct {
 	Namespace string
 	Bucket    string
-	Ctx       context.Context
 
-	tar string
+	tar         string
+	secretName  string
+	buildID     string
+	annotations map[string]string
 }
 
-//Cleanup removes the context from the gcs bucket and removes the gcs secret from the cluster
-func (g GCS) Cleanup() {
-	client, err := storage.NewClient(context.Background())
+//Cleanup removes the context from the gcs bucket and removes the gcs secret from the cluster.
+//Only objects which have been created are removed, so it is safe to call Cleanup at any time.
+func (g *GCS) Cleanup(ctx context.Context) {
+	if g.tar != "" {
+		g.deleteTar(ctx)
+	}
+
+	if g.secretName == "" {
+		return
+	}
+
+	k8sClient, err := kubernetes.GetClient()
 	if err != nil {
-		logrus.WithError(err).Errorln("error occurred while creating client")
+		util.Logger(ctx).WithError(err).Errorln("error occurred while getting k8s client")
 		return
 	}
 
-	if err := client.Bucket(g.Bucket).Object(g.tar).Delete(context.Background()); err != nil {
-		logrus.WithError(err).Errorln("error occurred while deleting tar from bucket")
+	if err := k8sClient.CoreV1().Secrets(g.Namespace).Delete(g.secretName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		util.Logger(ctx).WithError(err).Errorln("error occurred while deleting gcs secret")
 	}
+}
 
-	k8sClient, err := kubernetes.GetClient()
+func (g *GCS) deleteTar(ctx context.Context) {
+	client, err := storage.NewClient(ctx)
 	if err != nil {
-		logrus.WithError(err).Errorln("error occurred while getting k8s client")
+		util.Logger(ctx).WithError(err).Errorln("error occurred while creating client")
 		return
 	}
+	defer client.Close()
 
-	if err := k8sClient.CoreV1().Secrets(g.Namespace).Delete(credentialsSecretName, &metav1.DeleteOptions{}); err != nil {
-		logrus.WithError(err).Errorln("error occurred while deleting gcs secret")
+	if err := client.Bucket(g.Bucket).Object(g.tar).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+		util.Logger(ctx).WithError(err).Errorln("error occurred while deleting tar from bucket")
 	}
 }
 
 //PrepareCredentials creates a v1.Secret with the contents of the Service Account JSON
 //found at GOOGLE_APPLICATION_CREDENTIALS
-func (g GCS) PrepareCredentials() error {
+func (g *GCS) PrepareCredentials() error {
 	credsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
 	if credsPath == "" {
 		return errors.New("env var GOOGLE_APPLICATION_CREDENTIALS must be set")
@@ -84,33 +100,43 @@ func (g GCS) PrepareCredentials() error {
 		return errors.Wrap(err, "getting kubernetes client")
 	}
 
-	secret := &v1.Secret{
+	if _, err = client.CoreV1().Secrets(g.Namespace).Create(g.secret(creds)); err != nil {
+		return errors.Wrap(err, "creating gcs secret")
+	}
+
+	return nil
+}
+
+//secret returns the secret containing the service account json which is mounted into the Kaniko container
+func (g *GCS) secret(creds []byte) *v1.Secret {
+	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: credentialsSecretName,
+			Name: g.secretName,
 			Labels: map[string]string{
-				"builder": "kaniko",
+				constants.BuilderLabel: "kaniko",
+				constants.BuildIDLabel: g.buildID,
 			},
+			Annotations: g.annotations,
 		},
 		Data: map[string][]byte{
 			"kaniko-secret.json": creds,
 		},
 	}
-
-	if _, err = client.CoreV1().Secrets(g.Namespace).Create(secret); err != nil {
-		return errors.Wrap(err, "creating gcs secret")
-	}
-
-	return nil
 }
 
-//ModifyPod adds the gcs secret as a volume to the pod to access the bucket from Kaniko
-func (g GCS) ModifyPod(pod *v1.Pod) {
+//ModifyPod adds the gcs secret as a volume to the pod to access the bucket from Kaniko.
+//The secret is named after the build id of the pod, so concurrent builds don't share a secret.
+func (g *GCS) ModifyPod(pod *v1.Pod) {
+	g.buildID = pod.Labels[constants.BuildIDLabel]
+	g.annotations = pod.Annotations
+	g.secretName = fmt.Sprintf("%s-%s", credentialsSecretName, g.buildID)
+
 	//Mount gcs secret as volume
 	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
 		Name: "google-credentials",
 		VolumeSource: v1.VolumeSource{
 			Secret: &v1.SecretVolumeSource{
-				SecretName: credentialsSecretName,
+				SecretName: g.secretName,
 			},
 		},
 	})
@@ -129,11 +155,12 @@ func (g GCS) ModifyPod(pod *v1.Pod) {
 }
 
 //UploadTar uploads the build context to the specified gcs bucket
-func (g *GCS) UploadTar(pod *v1.Pod, tarPath string) error {
-	client, err := storage.NewClient(g.Ctx)
+func (g *GCS) UploadTar(ctx context.Context, pod *v1.Pod, tarPath string) error {
+	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return errors.Wrap(err, "creating storage client")
 	}
+	defer client.Close()
 
 	tar, err := os.Open(tarPath)
 	if err != nil {
@@ -142,7 +169,10 @@ func (g *GCS) UploadTar(pod *v1.Pod, tarPath string) error {
 	defer tar.Close()
 
 	g.tar = filepath.Base(tarPath)
-	writer := client.Bucket(g.Bucket).Object(g.tar).NewWriter(g.Ctx)
+	writer := client.Bucket(g.Bucket).Object(g.tar).NewWriter(ctx)
+	writer.Metadata = map[string]string{
+		constants.BuildIDMetadataKey: g.buildID, //allows "kbuild gc" to find the context if it's left behind
+	}
 
 	if _, err := io.Copy(writer, tar); err != nil {
 		return errors.Wrap(err, "copying tar to bucket")
@@ -152,10 +182,26 @@ func (g *GCS) UploadTar(pod *v1.Pod, tarPath string) error {
 		return errors.Wrap(err, "closing bucket writer")
 	}
 
-	pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, fmt.Sprintf("--context=gs://%s/%s", g.Bucket, g.tar))
+	container := kanikoContainer(pod)
+	container.Args = append(container.Args, "--context="+g.contextURL(g.tar))
 	return nil
 }
 
+//Plan adds the context argument to the pod and returns the gcs secret and the bucket object of the build context
+func (g *GCS) Plan(pod *v1.Pod, tarName string) Plan {
+	container := kanikoContainer(pod)
+	container.Args = append(container.Args, "--context="+g.contextURL(tarName))
+
+	return Plan{
+		Secrets: []*v1.Secret{g.secret(nil)},
+		Upload:  g.contextURL(tarName),
+	}
+}
+
+func (g *GCS) contextURL(tarName string) string {
+	return fmt.Sprintf("gs://%s/%s", g.Bucket, tarName)
+}
+
 //RequiresPod always returns false as the pod should not be started before the context is uploaded
 func (GCS) RequiresPod() bool {
 	return false
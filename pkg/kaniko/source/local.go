@@ -18,26 +18,25 @@ package source
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/cedrickring/kbuild/pkg/constants"
 	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/cedrickring/kbuild/pkg/util"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 //Local represents a local build context which gets uploaded to an init container
 type Local struct {
-	Ctx       context.Context
 	Namespace string
 }
 
 //Cleanup not needed here
-func (Local) Cleanup() {
+func (Local) Cleanup(ctx context.Context) {
 }
 
-//RequiresPod returns always true, since the init pod is required to upload the context
+//RequiresPod returns always true, since the running init container is required to upload the context
 func (Local) RequiresPod() bool {
 	return true
 }
@@ -53,7 +52,7 @@ func (Local) ModifyPod(pod *v1.Pod) {
 	pod.Spec.InitContainers = []v1.Container{
 		{
 			Name:  "kaniko-init",
-			Image: "alpine",
+			Image: constants.DefaultInitImage,
 			Args: []string{"sh", "-c",
 				`while true; do
 							sleep 1; if [ -f /tmp/complete ]; then break; fi
@@ -86,18 +85,14 @@ func (Local) ModifyPod(pod *v1.Pod) {
 	})
 }
 
-//UploadTar uploads the context tar to the init container
-func (l Local) UploadTar(pod *v1.Pod, tarPath string) error {
+//UploadTar uploads the context tar to the running init container
+func (l Local) UploadTar(ctx context.Context, pod *v1.Pod, tarPath string) error {
 	client, err := kubernetes.GetClient()
 	if err != nil {
 		return errors.Wrap(err, "getting kubernetes client")
 	}
 
-	if err := kubernetes.WaitForPodInitialized(l.Ctx, client, l.Namespace, pod.Name); err != nil && err != wait.ErrWaitTimeout {
-		return errors.Wrap(err, "wait for pod initialized")
-	}
-
-	logrus.Info("Copying build context into container...")
+	util.Logger(ctx).Info("Copying build context into container...")
 	initContainerName := pod.Spec.InitContainers[0].Name
 
 	tarCopy := kubernetes.Copy{
@@ -107,7 +102,7 @@ func (l Local) UploadTar(pod *v1.Pod, tarPath string) error {
 		SrcPath:   tarPath,
 		DestPath:  constants.KanikoBuildContextPath,
 	}
-	if err := tarCopy.CopyFileIntoPod(client); err != nil {
+	if err := tarCopy.CopyFileIntoPod(ctx, client); err != nil {
 		return errors.Wrap(err, "copying tar into init container")
 	}
 
@@ -121,6 +116,11 @@ func (l Local) UploadTar(pod *v1.Pod, tarPath string) error {
 		return errors.Wrap(err, "creating complete file in init container")
 	}
 
-	logrus.Info("Finished copying build context.")
+	util.Logger(ctx).Info("Finished copying build context.")
 	return nil
 }
+
+//Plan returns the init container the build context is copied into, no objects are created by this source
+func (Local) Plan(pod *v1.Pod, tarName string) Plan {
+	return Plan{Upload: fmt.Sprintf("%s:%s", pod.Spec.InitContainers[0].Name, constants.KanikoBuildContextPath)}
+}
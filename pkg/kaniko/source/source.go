@@ -16,13 +16,39 @@
 
 package source
 
-import v1 "k8s.io/api/core/v1"
+import (
+	"context"
+
+	"github.com/cedrickring/kbuild/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+)
 
 //Source represents a build context source
 type Source interface {
 	PrepareCredentials() error
 	ModifyPod(pod *v1.Pod)
-	UploadTar(pod *v1.Pod, tarPath string) error
-	Cleanup()
+	UploadTar(ctx context.Context, pod *v1.Pod, tarPath string) error
+	Cleanup(ctx context.Context)
 	RequiresPod() bool
+	//Plan modifies the pod like UploadTar and returns the objects the source would create,
+	//without contacting the cluster or uploading the build context
+	Plan(pod *v1.Pod, tarName string) Plan
+}
+
+//Plan contains the objects created by a source for a build
+type Plan struct {
+	//Secrets created in the cluster
+	Secrets []*v1.Secret
+	//Upload is the destination the build context is uploaded to
+	Upload string
+}
+
+//kanikoContainer returns the Kaniko container of the pod, which is the first container unless the pod overlay moved it
+func kanikoContainer(pod *v1.Pod) *v1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == constants.KanikoContainerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return &pod.Spec.Containers[0]
 }
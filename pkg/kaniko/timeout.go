@@ -0,0 +1,88 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+//Phases of a build which can be limited by a timeout
+const (
+	PhaseTotal    = "build"
+	PhaseContext  = "context packaging"
+	PhaseUpload   = "context upload"
+	PhasePodStart = "pod start"
+	PhaseBuild    = "kaniko build"
+	PhasePod      = "build pod"
+)
+
+//Timeouts limits the duration of a build and its phases, zero values disable the timeout
+type Timeouts struct {
+	Total    time.Duration
+	Context  time.Duration
+	Upload   time.Duration
+	PodStart time.Duration
+	Build    time.Duration
+	//Cleanup limits the time spent on deleting the resources of the build, defaults to DefaultCleanupTimeout
+	Cleanup time.Duration
+}
+
+//TimeoutError is returned if a phase of the build didn't finish in time
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	if e.Timeout <= 0 {
+		return fmt.Sprintf("%s timed out", e.Phase)
+	}
+	return fmt.Sprintf("%s timed out after %s", e.Phase, e.Timeout)
+}
+
+//activeDeadline returns the max duration the build pod may run, which is the sum of the phases
+//following the pod creation limited by the remaining time of the build. Zero is returned if there is no limit.
+func (b Build) activeDeadline(ctx context.Context) time.Duration {
+	var deadline time.Duration
+	if b.Timeouts.PodStart > 0 && b.Timeouts.Build > 0 && (b.Timeouts.Upload > 0 || !b.Source.RequiresPod()) {
+		deadline = b.Timeouts.PodStart + b.Timeouts.Build
+		if b.Source.RequiresPod() {
+			deadline += b.Timeouts.Upload
+		}
+	}
+
+	if ctxDeadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(ctxDeadline)
+		if deadline == 0 || remaining < deadline {
+			deadline = remaining
+		}
+	}
+
+	return deadline
+}
+
+//activeDeadlineSeconds converts the deadline to seconds as required by the pod spec, rounding up
+func activeDeadlineSeconds(deadline time.Duration) *int64 {
+	if deadline <= 0 {
+		return nil
+	}
+	seconds := int64(math.Ceil(deadline.Seconds()))
+	return &seconds
+}
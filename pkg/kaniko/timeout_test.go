@@ -0,0 +1,171 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kaniko
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cedrickring/kbuild/pkg/kaniko/source"
+	"github.com/cedrickring/kbuild/pkg/kubernetes"
+	"github.com/pkg/errors"
+)
+
+func TestActiveDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   source.Source
+		timeouts Timeouts
+		expected time.Duration
+	}{
+		{
+			name:   "no timeouts",
+			source: &source.Local{},
+		},
+		{
+			name:     "local context",
+			source:   &source.Local{},
+			timeouts: Timeouts{Upload: time.Minute, PodStart: 2 * time.Minute, Build: 10 * time.Minute},
+			expected: 13 * time.Minute,
+		},
+		{
+			name:     "local context without upload timeout",
+			source:   &source.Local{},
+			timeouts: Timeouts{PodStart: 2 * time.Minute, Build: 10 * time.Minute},
+		},
+		{
+			name:     "gcs context",
+			source:   &source.GCS{},
+			timeouts: Timeouts{Context: time.Minute, Upload: time.Minute, PodStart: 2 * time.Minute, Build: 10 * time.Minute},
+			expected: 12 * time.Minute,
+		},
+		{
+			name:     "gcs context without build timeout",
+			source:   &source.GCS{},
+			timeouts: Timeouts{PodStart: 2 * time.Minute},
+		},
+	}
+
+	for _, test := range tests {
+		b := Build{Source: test.source, Timeouts: test.timeouts}
+		if actual := b.activeDeadline(context.Background()); actual != test.expected {
+			t.Errorf("%s: expected deadline %s but got %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestActiveDeadlineRemainingTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		max      time.Duration
+	}{
+		{name: "no phase timeouts", max: 5 * time.Minute},
+		{name: "phases exceed remaining time", timeouts: Timeouts{PodStart: 2 * time.Minute, Build: 10 * time.Minute}, max: 5 * time.Minute},
+		{name: "phases within remaining time", timeouts: Timeouts{PodStart: time.Minute, Build: time.Minute}, max: 2 * time.Minute},
+	}
+
+	for _, test := range tests {
+		b := Build{Source: &source.GCS{}, Timeouts: test.timeouts}
+		actual := b.activeDeadline(ctx)
+		if actual > test.max || actual < test.max-time.Minute {
+			t.Errorf("%s: expected deadline of about %s but got %s", test.name, test.max, actual)
+		}
+	}
+}
+
+func TestActiveDeadlineSeconds(t *testing.T) {
+	if seconds := activeDeadlineSeconds(0); seconds != nil {
+		t.Errorf("Expected no deadline but got %d", *seconds)
+	}
+	if seconds := activeDeadlineSeconds(1500 * time.Millisecond); seconds == nil || *seconds != 2 {
+		t.Errorf("Expected deadline to be rounded up to 2 seconds but got %v", seconds)
+	}
+}
+
+func TestRunPhase(t *testing.T) {
+	errOther := errors.New("pod was deleted")
+	waitForCtx := func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.Wrap(ctx.Err(), "watching pod")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancelExpired := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelExpired()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		timeout  time.Duration
+		fn       func(ctx context.Context) error
+		expected error
+	}{
+		{
+			name: "succeeded",
+			ctx:  context.Background(),
+			fn:   func(context.Context) error { return nil },
+		},
+		{
+			name:     "phase timed out",
+			ctx:      context.Background(),
+			timeout:  10 * time.Millisecond,
+			fn:       waitForCtx,
+			expected: TimeoutError{Phase: PhasePodStart, Timeout: 10 * time.Millisecond},
+		},
+		{
+			name:     "build cancelled",
+			ctx:      cancelled,
+			timeout:  time.Minute,
+			fn:       waitForCtx,
+			expected: ErrorCancelled,
+		},
+		{
+			name:     "build timed out",
+			ctx:      expired,
+			timeout:  time.Minute,
+			fn:       waitForCtx,
+			expected: TimeoutError{Phase: PhaseTotal, Timeout: time.Hour},
+		},
+		{
+			name:     "pod deadline exceeded",
+			ctx:      context.Background(),
+			fn:       func(context.Context) error { return errors.Wrap(kubernetes.ErrorPodDeadlineExceeded, "pod kaniko") },
+			expected: TimeoutError{Phase: PhasePod, Timeout: 3 * time.Minute},
+		},
+		{
+			name:     "other error",
+			ctx:      context.Background(),
+			timeout:  time.Minute,
+			fn:       func(context.Context) error { return errOther },
+			expected: errOther,
+		},
+	}
+
+	for _, test := range tests {
+		b := Build{Timeouts: Timeouts{Total: time.Hour}, podDeadline: 3 * time.Minute}
+		if actual := b.runPhase(test.ctx, PhasePodStart, test.timeout, test.fn); actual != test.expected {
+			t.Errorf("%s: expected error %v but got %v", test.name, test.expected, actual)
+		}
+	}
+}
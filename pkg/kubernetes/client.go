@@ -17,9 +17,8 @@
 package kubernetes
 
 import (
-	"path/filepath"
+	"fmt"
 
-	"github.com/cedrickring/kbuild/pkg/util"
 	"github.com/pkg/errors"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" //auth for GKE clusters
@@ -27,7 +26,19 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-//GetClient creates a new kubernetes client with the kubeconfig at ~/.kube/config
+var (
+	kubeconfigPath string
+	kubeContext    string
+)
+
+//Configure sets the kubeconfig and context used by all clients. Empty values fall back to
+//$KUBECONFIG or ~/.kube/config and the current context respectively.
+func Configure(kubeconfig, context string) {
+	kubeconfigPath = kubeconfig
+	kubeContext = context
+}
+
+//GetClient creates a new kubernetes client with the configured kubeconfig
 func GetClient() (*kubernetes.Clientset, error) {
 	config, err := GetRestConfig()
 	if err != nil {
@@ -42,17 +53,64 @@ func GetClient() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
-//GetRestConfig returns a new rest.Config based on the kubeconfig at ~/.kube/config
+//GetRestConfig returns a new rest.Config based on the configured kubeconfig and context.
+//If there's no kubeconfig and no explicit context, the in-cluster service account config is used.
 func GetRestConfig() (*rest.Config, error) {
-	home := util.HomeDir()
-	if home == "" {
-		return nil, errors.New("Can't find kubeconfig at ~/.kube/config")
+	if kubeContext != "" {
+		raw, err := clientConfig().RawConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "reading kubeconfig")
+		}
+		//an explicit context must exist, falling back to the in-cluster config could build on another cluster
+		if _, ok := raw.Contexts[kubeContext]; !ok {
+			return nil, errors.Errorf("context %q not found in kubeconfig", kubeContext)
+		}
 	}
-	kubeconfigPath := filepath.Join(home, ".kube", "config")
 
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	config, err := clientConfig().ClientConfig()
 	if err != nil {
-		return nil, errors.Wrap(err, "build client config from flags")
+		return nil, errors.Wrap(err, "build client config from kubeconfig")
 	}
 	return config, nil
 }
+
+//DescribeConfig returns a human readable description of the cluster and context in use
+func DescribeConfig() (string, error) {
+	raw, err := clientConfig().RawConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "reading kubeconfig")
+	}
+
+	contextName := raw.CurrentContext
+	if kubeContext != "" {
+		contextName = kubeContext
+	}
+
+	context, ok := raw.Contexts[contextName]
+	if !ok {
+		if kubeContext == "" {
+			if _, err := rest.InClusterConfig(); err == nil {
+				return "in-cluster service account", nil
+			}
+		}
+		return "", errors.Errorf("context %q not found in kubeconfig", contextName)
+	}
+
+	server := ""
+	if cluster, ok := raw.Clusters[context.Cluster]; ok {
+		server = cluster.Server
+	}
+
+	return fmt.Sprintf(`context "%s" (cluster "%s" at %s)`, contextName, context.Cluster, server), nil
+}
+
+func clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules() //respects $KUBECONFIG and ~/.kube/config
+	loadingRules.ExplicitPath = kubeconfigPath
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
@@ -0,0 +1,69 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+contexts:
+- name: dev
+  context: {cluster: dev}
+clusters:
+- name: dev
+  cluster: {server: https://dev.example.com}
+`
+
+func TestUnknownContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Configure(path, "prod")
+	defer Configure("", "")
+
+	expected := `context "prod" not found in kubeconfig`
+	if _, err := GetRestConfig(); err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error %s but got %v", expected, err)
+	}
+	if _, err := DescribeConfig(); err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error %s but got %v", expected, err)
+	}
+
+	Configure(path, "dev")
+	description, err := DescribeConfig()
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if expected := `context "dev" (cluster "dev" at https://dev.example.com)`; description != expected {
+		t.Errorf("Expected %s but got %s", expected, description)
+	}
+}
@@ -17,9 +17,11 @@
 package kubernetes
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 
+	"github.com/cedrickring/kbuild/pkg/util"
 	"github.com/pkg/errors"
 	"k8s.io/client-go/kubernetes"
 )
@@ -33,8 +35,9 @@ type Copy struct {
 	DestPath  string
 }
 
-//CopyFileIntoPod copies the src .tar.gz into the specified container
-func (c Copy) CopyFileIntoPod(client *kubernetes.Clientset) error {
+//CopyFileIntoPod copies the src .tar.gz into the specified container.
+//The copy is aborted as soon as the context is done.
+func (c Copy) CopyFileIntoPod(ctx context.Context, client *kubernetes.Clientset) error {
 	if filepath.Ext(c.SrcPath) != ".gz" {
 		return errors.New("SrcPath must end with .gz")
 	}
@@ -53,8 +56,14 @@ func (c Copy) CopyFileIntoPod(client *kubernetes.Clientset) error {
 		Container: c.Container,
 
 		Command: tarCmd,
-		Stdin:   f,
+		Stdin:   util.ContextReader{Ctx: ctx, Reader: f},
 	}
 
-	return exec.Exec(client)
+	if err := exec.Exec(client); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,54 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+//SetPodOwnerReference makes the pod the owner of all secrets in the pod's namespace
+//matching the label selector, so they get garbage collected together with the pod
+func SetPodOwnerReference(clientset *kubernetes.Clientset, pod *v1.Pod, selector string) error {
+	ownerRef := podOwnerReference(pod)
+
+	secrets := clientset.CoreV1().Secrets(pod.Namespace)
+	secretList, err := secrets.List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return errors.Wrap(err, "listing secrets")
+	}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		secret.OwnerReferences = append(secret.OwnerReferences, ownerRef)
+		if _, err := secrets.Update(secret); err != nil {
+			return errors.Wrapf(err, "updating secret %s", secret.Name)
+		}
+	}
+
+	return nil
+}
+
+func podOwnerReference(pod *v1.Pod) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
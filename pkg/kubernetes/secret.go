@@ -0,0 +1,38 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+//RedactedValue replaces the values of secrets in rendered manifests
+const RedactedValue = "<redacted>"
+
+//RedactSecret returns a copy of the secret with all values replaced by RedactedValue, so it can be printed safely
+func RedactSecret(secret *v1.Secret) *v1.Secret {
+	redacted := secret.DeepCopy()
+	redacted.StringData = make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for key := range secret.Data {
+		redacted.StringData[key] = RedactedValue
+	}
+	for key := range secret.StringData {
+		redacted.StringData[key] = RedactedValue
+	}
+	redacted.Data = nil
+	return redacted
+}
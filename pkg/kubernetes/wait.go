@@ -18,60 +18,361 @@ package kubernetes
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/cedrickring/kbuild/pkg/util"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 )
 
-//WaitForPodInitialized waits for a specific pod to be initialized
-func WaitForPodInitialized(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) error {
-	logrus.Infof("Waiting for pod %s to be initialized", podName)
+//terminalWaitingReasons are container waiting reasons the build pod doesn't recover from on its own
+var terminalWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
 
-	pods := clientset.CoreV1().Pods(namespace)
+//UnschedulableGracePeriod is how long a pod may be unschedulable before kbuild gives up, it gives
+//the cluster autoscaler time to add a node. A NotTriggerScaleUp event of the autoscaler fails earlier.
+const UnschedulableGracePeriod = 5 * time.Minute
 
-	ctx, cancelTimeout := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancelTimeout()
+//recheckInterval is the interval of checking the last seen pod again, e.g. for the unschedulable grace period
+const recheckInterval = 15 * time.Second
 
-	return wait.PollImmediateUntil(500*time.Millisecond, func() (done bool, err error) {
-		pod, err := pods.Get(podName, metav1.GetOptions{})
+//podStartHints explain how to resolve a pod start error
+var podStartHints = map[string]string{
+	"ErrImagePull":               "Make sure the image exists and the cluster is allowed to pull it.",
+	"ImagePullBackOff":           "Make sure the image exists and the cluster is allowed to pull it.",
+	"InvalidImageName":           "Check the image reference of the container.",
+	"CreateContainerConfigError": "A secret or config map referenced by the pod is missing or invalid.",
+	"FailedScheduling":           "No node can run the build pod, check the resource quota of the namespace and the free resources and taints of the nodes.",
+	"NotTriggerScaleUp":          "No node can run the build pod and the cluster autoscaler can't add one, check the resource requests of the pod and the node pools.",
+}
 
-		if err != nil {
-			logrus.Infof("Getting pod %s", podName)
-			return false, nil
-		}
+//ErrorPodEvicted is returned if the pod was evicted from its node
+var ErrorPodEvicted = errors.New("pod was evicted")
+
+//ErrorPodDeadlineExceeded is returned if the pod was stopped because it exceeded its active deadline
+var ErrorPodDeadlineExceeded = errors.New("pod exceeded its active deadline")
+
+//PodStartError is returned if a pod can't be started, e.g. because an image can't be pulled or the pod can't be scheduled
+type PodStartError struct {
+	Pod       string
+	Container string
+	Reason    string
+	Message   string
+}
+
+func newPodStartError(pod, container, reason, message string) PodStartError {
+	return PodStartError{
+		Pod:       pod,
+		Container: container,
+		Reason:    reason,
+		Message:   message,
+	}
+}
+
+func (e PodStartError) Error() string {
+	subject := "pod " + e.Pod
+	if e.Container != "" {
+		subject = fmt.Sprintf("container %s of pod %s", e.Container, e.Pod)
+	}
+
+	msg := fmt.Sprintf("%s can't be started (%s): %s", subject, e.Reason, e.Message)
+	if hint, ok := podStartHints[e.Reason]; ok {
+		msg += " " + hint
+	}
+	return msg
+}
+
+//podCondition returns true once the pod reached the desired state
+type podCondition func(pod *v1.Pod) bool
 
+//WaitForPodInitialized waits for an init container of a specific pod to be running
+func WaitForPodInitialized(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) error {
+	util.Logger(ctx).Infof("Waiting for pod %s to be initialized", podName)
+
+	_, err := waitForPod(ctx, clientset, namespace, podName, func(pod *v1.Pod) bool {
 		for _, init := range pod.Status.InitContainerStatuses {
 			if init.State.Running != nil {
-				return true, nil
+				return true
 			}
 		}
+		return false
+	})
+	return err
+}
 
-		return false, nil
-	}, ctx.Done())
+//WaitForPodStarted waits for a container of a specific pod to be running or terminated
+func WaitForPodStarted(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) error {
+	util.Logger(ctx).Infof("Waiting for pod %s to be started", podName)
+
+	_, err := waitForPod(ctx, clientset, namespace, podName, func(pod *v1.Pod) bool {
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.State.Running != nil || container.State.Terminated != nil {
+				return true
+			}
+		}
+		return false
+	})
+	return err
+}
+
+//WaitForPodComplete waits for a specific pod to be in complete state and returns the completed pod
+func WaitForPodComplete(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) (*v1.Pod, error) {
+	return waitForPod(ctx, clientset, namespace, podName, func(pod *v1.Pod) bool {
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.State.Terminated != nil {
+				return true
+			}
+		}
+		return false
+	})
 }
 
-//WaitForPodComplete waits for a specific pod to be in complete state
-func WaitForPodComplete(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string, finish chan bool) error {
+//waitForPod watches the pod until the condition is met, the pod runs into a problem or the context is done.
+//The watch is resumed from the last seen resource version if it gets closed by the api server.
+func waitForPod(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string, condition podCondition) (*v1.Pod, error) {
 	pods := clientset.CoreV1().Pods(namespace)
+	w := &podWatcher{
+		condition: condition,
+		reported:  make(map[string]bool),
+		log:       util.Logger(ctx),
+	}
 
-	return wait.PollImmediateUntil(500*time.Millisecond, func() (done bool, err error) {
-		pod, err := pods.Get(podName, metav1.GetOptions{})
+	//events aren't required to wait for the pod, they only allow to fail earlier
+	events, err := clientset.CoreV1().Events(namespace).Watch(metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod", "involvedObject.name": podName}.AsSelector().String(),
+	})
+	if err != nil {
+		util.Logger(ctx).Debugf("Can't watch events of pod %s: %s", podName, err)
+	} else {
+		defer events.Stop()
+		w.events = events.ResultChan()
+	}
 
+	pod, err := pods.Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting pod")
+	}
+
+	for {
+		if done, err := w.check(pod); done {
+			return pod, err
+		}
+
+		watcher, err := pods.Watch(metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", podName).String(),
+			ResourceVersion: pod.ResourceVersion,
+		})
 		if err != nil {
-			logrus.Infof("Getting pod %s", podName)
-			return false, nil
+			return nil, errors.Wrap(err, "watching pod")
+		}
+
+		updated, done, err := w.watch(ctx, watcher)
+		watcher.Stop()
+		if done {
+			return updated, err
 		}
 
-		for _, init := range pod.Status.ContainerStatuses {
-			if init.State.Terminated != nil {
-				finish <- true
-				return true, nil
+		if updated != nil {
+			pod = updated
+		} else { //resource version is too old to resume the watch
+			pod, err = pods.Get(podName, metav1.GetOptions{})
+			if err != nil {
+				return nil, errors.Wrap(err, "getting pod")
 			}
 		}
+	}
+}
+
+//podWatcher checks pod updates and events for the desired pod state or problems preventing the pod from starting
+type podWatcher struct {
+	condition podCondition
+	events    <-chan watch.Event
+	reported  map[string]bool
+	last      *v1.Pod //last checked pod
+	log       *logrus.Entry
+}
+
+//watch processes pod updates and events until the condition is met or the pod watch is closed.
+//Returns the last seen pod and false if the watch has to be resumed.
+func (w *podWatcher) watch(ctx context.Context, watcher watch.Interface) (*v1.Pod, bool, error) {
+	var last *v1.Pod
+
+	ticker := time.NewTicker(recheckInterval)
+	defer ticker.Stop()
 
-		return false, nil
-	}, ctx.Done())
+	for {
+		select {
+		case <-ticker.C:
+			if w.last != nil {
+				if done, err := w.check(w.last); done {
+					return w.last, true, err
+				}
+			}
+		case <-ctx.Done():
+			return last, true, ctx.Err()
+		case event, ok := <-w.events:
+			if !ok {
+				w.events = nil //stop receiving events but keep watching the pod
+				continue
+			}
+
+			if e, ok := event.Object.(*v1.Event); ok && event.Type != watch.Deleted {
+				if err := eventError(e); err != nil {
+					return last, true, err
+				}
+				w.reportEvent(e)
+			}
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return last, false, nil
+			}
+
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				pod, ok := event.Object.(*v1.Pod)
+				if !ok {
+					continue
+				}
+				last = pod
+
+				if done, err := w.check(pod); done {
+					return pod, true, err
+				}
+			case watch.Deleted:
+				return last, true, errors.New("pod was deleted")
+			case watch.Error:
+				status := apierrors.FromObject(event.Object)
+				if apierrors.IsResourceExpired(status) || apierrors.IsGone(status) {
+					return nil, false, nil
+				}
+				return last, true, errors.Wrap(status, "watching pod")
+			}
+		}
+	}
+}
+
+//check returns true if the condition is met or the pod ran into a problem it can't recover from
+func (w *podWatcher) check(pod *v1.Pod) (bool, error) {
+	w.last = pod
+	if w.condition(pod) {
+		return true, nil
+	}
+
+	if err := podError(pod, time.Now()); err != nil {
+		return true, err
+	}
+
+	w.report(pod)
+	return false, nil
+}
+
+//report logs the reasons a pod is waiting for, but only once per distinct reason
+func (w *podWatcher) report(pod *v1.Pod) {
+	var messages []string
+	if condition := unschedulable(pod); condition != nil {
+		messages = append(messages, "Pod "+pod.Name+" is unschedulable: "+condition.Message)
+	}
+	for _, status := range allContainerStatuses(pod) {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" && waiting.Reason != "PodInitializing" && waiting.Reason != "ContainerCreating" {
+			messages = append(messages, "Container "+status.Name+" is waiting: "+waiting.Reason+" "+waiting.Message)
+		}
+	}
+
+	for _, message := range messages {
+		w.warnOnce(message)
+	}
+}
+
+//reportEvent logs scheduling failures, which are retried until the grace period is over or the autoscaler gives up
+func (w *podWatcher) reportEvent(event *v1.Event) {
+	if event.Type == v1.EventTypeWarning && event.Reason == "FailedScheduling" {
+		w.warnOnce(fmt.Sprintf("Pod %s can't be scheduled yet, waiting up to %s for a node: %s", event.InvolvedObject.Name, UnschedulableGracePeriod, event.Message))
+	}
+}
+
+func (w *podWatcher) warnOnce(message string) {
+	if !w.reported[message] {
+		w.reported[message] = true
+		w.log.Warn(message)
+	}
+}
+
+//podError returns an actionable error if the pod or one of its containers failed or can't be started.
+//An unschedulable pod only fails once it has been unschedulable for the UnschedulableGracePeriod at the given time.
+func podError(pod *v1.Pod, now time.Time) error {
+	if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
+		return errors.Wrapf(ErrorPodEvicted, "pod %s: %s", pod.Name, pod.Status.Message)
+	}
+
+	if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "DeadlineExceeded" {
+		return errors.Wrapf(ErrorPodDeadlineExceeded, "pod %s: %s", pod.Name, pod.Status.Message)
+	}
+
+	if condition := unschedulable(pod); condition != nil && !condition.LastTransitionTime.IsZero() && now.Sub(condition.LastTransitionTime.Time) >= UnschedulableGracePeriod {
+		return newPodStartError(pod.Name, "", "FailedScheduling", condition.Message)
+	}
+
+	for _, status := range allContainerStatuses(pod) {
+		if waiting := status.State.Waiting; waiting != nil && terminalWaitingReasons[waiting.Reason] {
+			message := waiting.Message
+			if status.Image != "" && (waiting.Reason == "ErrImagePull" || waiting.Reason == "ImagePullBackOff") {
+				message = fmt.Sprintf("image %s: %s", status.Image, message)
+			}
+			return newPodStartError(pod.Name, status.Name, waiting.Reason, message)
+		}
+
+		if terminated := status.State.Terminated; terminated != nil && terminated.Reason == "OOMKilled" && isInitContainer(pod, status.Name) {
+			return errors.Errorf("container %s was OOMKilled, increase its memory limit", status.Name)
+		}
+	}
+
+	if pod.Status.Phase == v1.PodFailed {
+		return errors.Errorf("pod %s failed: %s %s", pod.Name, pod.Status.Reason, pod.Status.Message)
+	}
+
+	return nil
+}
+
+//eventError returns an error for events indicating that the pod will never be started.
+//FailedScheduling isn't terminal, the cluster autoscaler may add a node, but NotTriggerScaleUp means it won't.
+func eventError(event *v1.Event) error {
+	if event.Reason == "NotTriggerScaleUp" {
+		return newPodStartError(event.InvolvedObject.Name, "", event.Reason, event.Message)
+	}
+	return nil
+}
+
+//unschedulable returns the PodScheduled condition if the scheduler can't find a node for the pod
+func unschedulable(pod *v1.Pod) *v1.PodCondition {
+	for i, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func allContainerStatuses(pod *v1.Pod) []v1.ContainerStatus {
+	statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	return append(statuses, pod.Status.ContainerStatuses...)
+}
+
+func isInitContainer(pod *v1.Pod, name string) bool {
+	for _, container := range pod.Spec.InitContainers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,203 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func unschedulablePod(since time.Time) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kaniko"},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			Conditions: []v1.PodCondition{{
+				Type:               v1.PodScheduled,
+				Status:             v1.ConditionFalse,
+				Reason:             v1.PodReasonUnschedulable,
+				Message:            "0/3 nodes are available: 3 Insufficient memory.",
+				LastTransitionTime: metav1.NewTime(since),
+			}},
+		},
+	}
+}
+
+func waitingPod(reason string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kaniko"},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:  "kaniko-build",
+				Image: "executor:v1.6.0",
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason, Message: "details"}},
+			}},
+		},
+	}
+}
+
+func TestPodError(t *testing.T) {
+	now := time.Now()
+
+	oomKilled := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kaniko"},
+		Spec:       v1.PodSpec{InitContainers: []v1.Container{{Name: "kaniko-init"}}},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			InitContainerStatuses: []v1.ContainerStatus{{
+				Name:  "kaniko-init",
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		pod           *v1.Pod
+		expectedCause error
+		expectedErr   string
+		startError    bool
+	}{
+		{
+			name: "running",
+			pod:  &v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}},
+		},
+		{
+			name:          "evicted",
+			pod:           &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kaniko"}, Status: v1.PodStatus{Phase: v1.PodFailed, Reason: "Evicted", Message: "node is low on ephemeral-storage"}},
+			expectedCause: ErrorPodEvicted,
+			expectedErr:   "node is low on ephemeral-storage",
+		},
+		{
+			name:          "deadline exceeded",
+			pod:           &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kaniko"}, Status: v1.PodStatus{Phase: v1.PodFailed, Reason: "DeadlineExceeded"}},
+			expectedCause: ErrorPodDeadlineExceeded,
+		},
+		{
+			name:        "failed",
+			pod:         &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kaniko"}, Status: v1.PodStatus{Phase: v1.PodFailed, Reason: "NodeLost"}},
+			expectedErr: "pod kaniko failed: NodeLost",
+		},
+		{
+			name:        "image pull backoff",
+			pod:         waitingPod("ImagePullBackOff"),
+			expectedErr: "image executor:v1.6.0: details",
+			startError:  true,
+		},
+		{
+			name:        "err image pull",
+			pod:         waitingPod("ErrImagePull"),
+			expectedErr: "(ErrImagePull)",
+			startError:  true,
+		},
+		{
+			name:        "invalid image name",
+			pod:         waitingPod("InvalidImageName"),
+			expectedErr: "(InvalidImageName)",
+			startError:  true,
+		},
+		{
+			name:        "create container config error",
+			pod:         waitingPod("CreateContainerConfigError"),
+			expectedErr: "secret or config map",
+			startError:  true,
+		},
+		{
+			name: "container creating",
+			pod:  waitingPod("ContainerCreating"),
+		},
+		{
+			name:        "init container oom killed",
+			pod:         oomKilled,
+			expectedErr: "container kaniko-init was OOMKilled",
+		},
+		{
+			name: "unschedulable within grace period",
+			pod:  unschedulablePod(now.Add(-time.Minute)),
+		},
+		{
+			name:        "unschedulable after grace period",
+			pod:         unschedulablePod(now.Add(-UnschedulableGracePeriod)),
+			expectedErr: "Insufficient memory",
+			startError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		err := podError(test.pod, now)
+		if test.expectedErr == "" && test.expectedCause == nil {
+			if err != nil {
+				t.Errorf("%s: expected no error but got %s", test.name, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: expected an error but got none", test.name)
+			continue
+		}
+		if test.expectedCause != nil && errors.Cause(err) != test.expectedCause {
+			t.Errorf("%s: expected cause %s but got %s", test.name, test.expectedCause, err)
+		}
+		if !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("%s: expected error %s but got %s", test.name, test.expectedErr, err)
+		}
+		if _, ok := err.(PodStartError); ok != test.startError {
+			t.Errorf("%s: expected PodStartError %t but got %T", test.name, test.startError, err)
+		}
+	}
+}
+
+func TestEventError(t *testing.T) {
+	tests := []struct {
+		event       v1.Event
+		expectedErr string
+	}{
+		{
+			event: v1.Event{Type: v1.EventTypeWarning, Reason: "FailedScheduling", Message: "0/3 nodes are available"},
+		},
+		{
+			event: v1.Event{Type: v1.EventTypeNormal, Reason: "TriggeredScaleUp", Message: "pod triggered scale-up"},
+		},
+		{
+			event:       v1.Event{Type: v1.EventTypeNormal, Reason: "NotTriggerScaleUp", Message: "pod didn't trigger scale-up"},
+			expectedErr: "pod kaniko can't be started (NotTriggerScaleUp): pod didn't trigger scale-up",
+		},
+	}
+
+	for _, test := range tests {
+		test.event.InvolvedObject = v1.ObjectReference{Kind: "Pod", Name: "kaniko"}
+
+		err := eventError(&test.event)
+		if test.expectedErr == "" {
+			if err != nil {
+				t.Errorf("%s: expected no error but got %s", test.event.Reason, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("%s: expected error %s but got %v", test.event.Reason, test.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package patch
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//validateOperations checks the RFC 6902 operations of a json patch before they are applied
+func validateOperations(values []interface{}) error {
+	for i, value := range values {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("operation %d: must be an object", i)
+		}
+
+		op, _ := m["op"].(string)
+		switch op {
+		case "add", "replace", "test":
+			if _, ok := m["value"]; !ok {
+				return errors.Errorf("operation %d: %s requires a value", i, op)
+			}
+		case "move", "copy":
+			from, ok := m["from"].(string)
+			if !ok {
+				return errors.Errorf("operation %d: %s requires from", i, op)
+			}
+			if err := validatePointer(from); err != nil {
+				return errors.Wrapf(err, "operation %d", i)
+			}
+		case "remove":
+		default:
+			return errors.Errorf("operation %d: unknown op %q", i, op)
+		}
+
+		path, _ := m["path"].(string)
+		if err := validatePointer(path); err != nil {
+			return errors.Wrapf(err, "operation %d", i)
+		}
+	}
+	return nil
+}
+
+//validatePointer checks that the RFC 6901 json pointer is empty or starts with a slash
+func validatePointer(pointer string) error {
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return errors.Errorf("invalid path %q, must start with /", pointer)
+	}
+	return nil
+}
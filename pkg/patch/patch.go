@@ -0,0 +1,130 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+)
+
+//Type is the kind of a patch
+type Type string
+
+//Supported patch types
+const (
+	//StrategicMerge patches are partial objects merged into the original object, lists of
+	//kubernetes objects are merged by the key defined in the patchMergeKey struct tag (e.g. containers by name)
+	StrategicMerge Type = "strategic-merge"
+	//JSON patches are a list of RFC 6902 operations
+	JSON Type = "json"
+)
+
+//Patch is a yaml or json encoded modification of an object
+type Patch struct {
+	Type Type
+	data []byte //json encoded patch
+}
+
+//Load reads a patch file, see Parse
+func Load(path string) (*Patch, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading patch file")
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid patch file %s", path)
+	}
+	return p, nil
+}
+
+//Parse parses a yaml or json encoded patch. A list is parsed as JSON patch, an object as strategic merge patch.
+func Parse(data []byte) (*Patch, error) {
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing yaml")
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(js, &parsed); err != nil {
+		return nil, errors.Wrap(err, "parsing patch")
+	}
+
+	switch v := parsed.(type) {
+	case map[string]interface{}:
+		return &Patch{Type: StrategicMerge, data: js}, nil
+	case []interface{}:
+		if err := validateOperations(v); err != nil {
+			return nil, err
+		}
+		return &Patch{Type: JSON, data: js}, nil
+	}
+
+	return nil, errors.New("patch must be an object (strategic merge) or a list of operations (json patch)")
+}
+
+//Apply applies the patch to the object, which has to be a pointer to a struct.
+//Strategic merge patches use the struct tags of the object (e.g. patchStrategy and patchMergeKey of v1.Pod) as schema.
+//The patched object is decoded strictly, so a patch introducing unknown fields fails.
+func (p Patch) Apply(obj interface{}) error {
+	t := reflect.TypeOf(obj)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return errors.New("object to patch must be a pointer")
+	}
+
+	js, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrap(err, "encoding object")
+	}
+
+	switch p.Type {
+	case StrategicMerge:
+		js, err = strategicpatch.StrategicMergePatch(js, p.data, reflect.New(t.Elem()).Interface())
+		if err != nil {
+			return errors.Wrap(err, "applying strategic merge patch")
+		}
+	case JSON:
+		ops, err := jsonpatch.DecodePatch(p.data)
+		if err != nil {
+			return errors.Wrap(err, "decoding json patch")
+		}
+		js, err = ops.Apply(js)
+		if err != nil {
+			return errors.Wrap(err, "applying json patch")
+		}
+	default:
+		return errors.Errorf("unknown patch type %s", p.Type)
+	}
+
+	//reset the object first, fields removed by the patch would be kept otherwise
+	reflect.ValueOf(obj).Elem().Set(reflect.Zero(t.Elem()))
+
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return errors.Wrap(err, "decoding patched object")
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package patch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type testMeta struct {
+	Name        string            `json:"name,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type testContainer struct {
+	Name  string   `json:"name"`
+	Image string   `json:"image,omitempty"`
+	Args  []string `json:"args,omitempty"`
+}
+
+type testSpec struct {
+	Containers []testContainer `json:"containers" patchStrategy:"merge" patchMergeKey:"name"`
+	Finalizers []string        `json:"finalizers,omitempty" patchStrategy:"merge"`
+	Hostname   string          `json:"hostname,omitempty"`
+}
+
+type testObject struct {
+	testMeta `json:",inline"`
+	Spec     testSpec `json:"spec"`
+}
+
+func newTestObject() *testObject {
+	return &testObject{
+		testMeta: testMeta{Name: "kaniko"},
+		Spec: testSpec{
+			Containers: []testContainer{
+				{Name: "kaniko-build", Image: "executor", Args: []string{"--dockerfile=Dockerfile"}},
+			},
+			Finalizers: []string{"a"},
+			Hostname:   "builder",
+		},
+	}
+}
+
+func TestStrategicMerge(t *testing.T) {
+	p, err := Parse([]byte(`
+annotations:
+  sidecar.istio.io/inject: "false"
+spec:
+  hostname: null
+  finalizers: [a, b]
+  containers:
+  - name: kaniko-build
+    image: executor:v1.0.0
+  - name: sidecar
+    image: busybox
+`))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if p.Type != StrategicMerge {
+		t.Fatalf("Expected patch type %s but got %s", StrategicMerge, p.Type)
+	}
+
+	obj := newTestObject()
+	if err := p.Apply(obj); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := &testObject{
+		testMeta: testMeta{Name: "kaniko", Annotations: map[string]string{"sidecar.istio.io/inject": "false"}},
+		Spec: testSpec{
+			Containers: []testContainer{
+				{Name: "kaniko-build", Image: "executor:v1.0.0", Args: []string{"--dockerfile=Dockerfile"}},
+				{Name: "sidecar", Image: "busybox"},
+			},
+			Finalizers: []string{"a", "b"},
+		},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, obj)
+	}
+}
+
+func TestStrategicMergeDirectives(t *testing.T) {
+	p, err := Parse([]byte(`
+spec:
+  containers:
+  - name: kaniko-build
+    $patch: delete
+  - name: other
+    image: busybox
+`))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	obj := newTestObject()
+	if err := p.Apply(obj); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := []testContainer{{Name: "other", Image: "busybox"}}
+	if !reflect.DeepEqual(obj.Spec.Containers, expected) {
+		t.Errorf("Expected containers %+v but got %+v", expected, obj.Spec.Containers)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	p, err := Parse([]byte(`[
+  {"op": "add", "path": "/spec/containers/0/args/-", "value": "--reproducible"},
+  {"op": "replace", "path": "/spec/hostname", "value": "kbuild"},
+  {"op": "add", "path": "/annotations", "value": {"a~b/c": "d"}},
+  {"op": "remove", "path": "/spec/finalizers"},
+  {"op": "test", "path": "/annotations/a~0b~1c", "value": "d"}
+]`))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if p.Type != JSON {
+		t.Fatalf("Expected patch type %s but got %s", JSON, p.Type)
+	}
+
+	obj := newTestObject()
+	if err := p.Apply(obj); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := &testObject{
+		testMeta: testMeta{Name: "kaniko", Annotations: map[string]string{"a~b/c": "d"}},
+		Spec: testSpec{
+			Containers: []testContainer{
+				{Name: "kaniko-build", Image: "executor", Args: []string{"--dockerfile=Dockerfile", "--reproducible"}},
+			},
+			Hostname: "kbuild",
+		},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, obj)
+	}
+}
+
+func TestJSONPatchCopy(t *testing.T) {
+	p, err := Parse([]byte(`[
+  {"op": "copy", "from": "/spec/containers/0", "path": "/spec/containers/-"},
+  {"op": "replace", "path": "/spec/containers/1/name", "value": "copy"},
+  {"op": "add", "path": "/spec/containers/1/args/-", "value": "--reproducible"}
+]`))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	obj := newTestObject()
+	if err := p.Apply(obj); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := []testContainer{
+		{Name: "kaniko-build", Image: "executor", Args: []string{"--dockerfile=Dockerfile"}},
+		{Name: "copy", Image: "executor", Args: []string{"--dockerfile=Dockerfile", "--reproducible"}},
+	}
+	if !reflect.DeepEqual(obj.Spec.Containers, expected) {
+		t.Errorf("Expected containers %+v but got %+v", expected, obj.Spec.Containers)
+	}
+}
+
+func TestStrategicMergePod(t *testing.T) {
+	p, err := Parse([]byte(`
+metadata:
+  $deleteFromPrimitiveList/finalizers: [kbuild/cleanup]
+spec:
+  $setElementOrder/volumes:
+  - name: cache
+  - name: docker-config
+  volumes:
+  - name: docker-config
+    $retainKeys: [name, secret]
+    secret:
+      secretName: docker-config
+`))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Finalizers: []string{"kbuild/cleanup", "other"}},
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{
+				{Name: "docker-config", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	if err := p.Apply(pod); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expectedVolumes := []v1.Volume{
+		{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		{Name: "docker-config", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "docker-config"}}},
+	}
+	if !reflect.DeepEqual(pod.Spec.Volumes, expectedVolumes) {
+		t.Errorf("Expected volumes %+v but got %+v", expectedVolumes, pod.Spec.Volumes)
+	}
+
+	expectedFinalizers := []string{"other"}
+	if !reflect.DeepEqual(pod.Finalizers, expectedFinalizers) {
+		t.Errorf("Expected finalizers %v but got %v", expectedFinalizers, pod.Finalizers)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		patch       string
+		expectedErr string
+	}{
+		{
+			patch:       `spec: {containers: [{name: kaniko-build, imag: executor}]}`,
+			expectedErr: `unknown field "imag"`,
+		},
+		{
+			patch:       `[{op: remove, path: /spec/volumes}]`,
+			expectedErr: "applying json patch",
+		},
+		{
+			patch:       `[{op: test, path: /spec/hostname, value: other}]`,
+			expectedErr: "applying json patch",
+		},
+		{
+			patch:       `[{op: add, path: /spec/containers/2, value: {}}]`,
+			expectedErr: "applying json patch",
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse([]byte(test.patch))
+		if err == nil {
+			err = p.Apply(newTestObject())
+		}
+
+		if err == nil {
+			t.Errorf("Expected error %s but got none", test.expectedErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("Expected error %s but got %s", test.expectedErr, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, patch := range []string{`"string"`, `[{op: merge, path: /spec}]`, `[{op: add, path: spec, value: 1}]`, `[{op: add, path: /spec}]`} {
+		if _, err := Parse([]byte(patch)); err == nil {
+			t.Errorf("Expected error for %s but got none", patch)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type loggerKey struct{}
+
+//WithLogger returns a context carrying the log entry, e.g. one with the build name as field to tell parallel builds apart
+func WithLogger(ctx context.Context, log *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+//Logger returns the log entry of the context or an entry of the standard logger if the context has none
+func Logger(ctx context.Context) *logrus.Entry {
+	if log, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return log
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
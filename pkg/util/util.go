@@ -39,3 +39,32 @@ func RandomID() string {
 	}
 	return fmt.Sprintf("%x", b)
 }
+
+//FormatBytes returns the size in a human readable format, e.g. "1.5 MB"
+func FormatBytes(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
+
+//Creator returns the user and host running kbuild, e.g. "user@host"
+func Creator() string {
+	user := os.Getenv("USER") //unix
+	if user == "" {
+		user = os.Getenv("USERNAME") //windows
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return user
+	}
+	return fmt.Sprintf("%s@%s", user, host)
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright 2018 Cedric Kring
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+//PrefixWriter prefixes every line written to the underlying writer, so output of parallel builds can be told apart
+type PrefixWriter struct {
+	Prefix string
+	Out    io.Writer
+
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+//Write buffers p and writes all complete lines with the prefix to the underlying writer
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		line := append([]byte(w.Prefix), w.buf.Next(i+1)...)
+		if _, err := w.Out.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+//Flush writes any remaining incomplete line to the underlying writer
+func (w *PrefixWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	line := append([]byte(w.Prefix), w.buf.Bytes()...)
+	w.buf.Reset()
+	_, err := w.Out.Write(append(line, '\n'))
+	return err
+}
+
+//ContextWriter fails all writes once the context is done
+type ContextWriter struct {
+	Ctx    context.Context
+	Writer io.Writer
+}
+
+func (w ContextWriter) Write(p []byte) (int, error) {
+	if err := w.Ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.Writer.Write(p)
+}
+
+//ContextReader fails all reads once the context is done
+type ContextReader struct {
+	Ctx    context.Context
+	Reader io.Reader
+}
+
+func (r ContextReader) Read(p []byte) (int, error) {
+	if err := r.Ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+//CountingWriter discards all writes and counts the written bytes
+type CountingWriter struct {
+	Count int64
+}
+
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	w.Count += int64(len(p))
+	return len(p), nil
+}